@@ -0,0 +1,159 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of environment variables that set flags.
+const envPrefix = "VICTOR_"
+
+// envName returns the name of the environment variable for the named
+// flag, for example VICTOR_THRESH_PERCENTILE for -thresh-percentile.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// setFromEnv sets each flag in fs that was not set on the command line
+// from its environment variable if that is set.
+func setFromEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if e := fs.Set(f.Name, v); e != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", v, envName(f.Name), e)
+		}
+	})
+	return err
+}
+
+// setFromConfig sets each flag in fs that has not already been set from
+// the named JSON config file. The file holds a single object mapping flag
+// names, without the leading hyphen, to values, for example
+//
+//	{"thresh": 0.1, "cliques": true, "dot": "families.dot"}
+func setFromConfig(fs *flag.FlagSet, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	var cfg map[string]interface{}
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return fmt.Errorf("invalid config %q: %v", file, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, v := range cfg {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("invalid config %q: unknown flag %q", file, name)
+		}
+		if set[name] {
+			continue
+		}
+		err = fs.Set(name, fmt.Sprint(v))
+		if err != nil {
+			return fmt.Errorf("invalid config %q: invalid value %v for %s: %v", file, v, name, err)
+		}
+	}
+	return nil
+}
+
+// meta is the run metadata written by -meta-out. When more
+// than one input is given each is described in Inputs and
+// Input is empty.
+type meta struct {
+	Version    string            `json:"version"`
+	Schema     int               `json:"schema"`
+	Parameters map[string]string `json:"parameters"`
+	Input      inputMeta         `json:"input"`
+	Inputs     []inputMeta       `json:"inputs,omitempty"`
+	Summary    summary           `json:"summary"`
+	Elapsed    float64           `json:"elapsed_seconds"`
+}
+
+// inputMeta describes an input file. Size and SHA256 are
+// only given for local files.
+type inputMeta struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// describeInput returns the description of the named input,
+// hashing it if it is a local file.
+func describeInput(name string) inputMeta {
+	in := inputMeta{Name: name}
+	if name == "-" || strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		return in
+	}
+	f, err := os.Open(name)
+	if err == nil {
+		h := sha256.New()
+		in.Size, err = io.Copy(h, f)
+		f.Close()
+		if err == nil {
+			in.SHA256 = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	if err != nil {
+		log.Printf("failed to hash %q for metadata: %v", name, err)
+	}
+	return in
+}
+
+// writeMeta writes the victor and schema versions, the effective values
+// of the flags in fs, a description of the input, the run summary and the
+// elapsed time to the named file as JSON.
+func writeMeta(file string, fs *flag.FlagSet, sum summary, elapsed time.Duration) {
+	m := meta{
+		Version:    buildVersion(),
+		Schema:     schemaVersion,
+		Parameters: make(map[string]string),
+		Summary:    sum,
+		Elapsed:    elapsed.Seconds(),
+	}
+	fs.VisitAll(func(f *flag.Flag) { m.Parameters[f.Name] = f.Value.String() })
+	names := strings.Split(*in, ",")
+	if len(names) == 1 {
+		m.Input = describeInput(*in)
+	} else {
+		for _, name := range names {
+			m.Inputs = append(m.Inputs, describeInput(name))
+		}
+	}
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		log.Printf("failed to create metadata: %v", err)
+		return
+	}
+	err = os.WriteFile(file, append(b, '\n'), 0644)
+	if err != nil {
+		log.Printf("failed to write %q metadata: %v", file, err)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/biogo/examples/igor/victor/victor"
+)
+
+// tree is a node in a hierarchical clustering dendrogram. Leaves
+// hold a family ID.
+type tree struct {
+	id          int64
+	left, right *tree
+	height      float64
+	size        int
+}
+
+// agglomerate performs agglomerative hierarchical clustering of fams
+// using the distance derived from pairs by c, as for writeDistances, and
+// returns the root of the resulting dendrogram. The linkage is one of "single",
+// "complete" or "average".
+func agglomerate(c *victor.Connector, fams []victor.Family, pairs []victor.Similarity, linkage string) *tree {
+	if len(fams) == 0 {
+		return nil
+	}
+	sim := similarities(c, pairs)
+
+	nodes := make([]*tree, len(fams))
+	dist := make([][]float64, len(fams))
+	for i, a := range fams {
+		nodes[i] = &tree{id: a.ID, size: 1}
+		dist[i] = make([]float64, len(fams))
+		for j, b := range fams {
+			if i != j {
+				dist[i][j] = 1 - sim[[2]int64{a.ID, b.ID}]
+			}
+		}
+	}
+
+	for len(nodes) > 1 {
+		// Find the closest pair of active clusters.
+		mi, mj := 0, 1
+		min := math.Inf(1)
+		for i := range nodes {
+			for j := i + 1; j < len(nodes); j++ {
+				if dist[i][j] < min {
+					min = dist[i][j]
+					mi, mj = i, j
+				}
+			}
+		}
+
+		// Merge them into mi and update distances
+		// using the Lance-Williams recurrence.
+		a, b := nodes[mi], nodes[mj]
+		for k := range nodes {
+			if k == mi || k == mj {
+				continue
+			}
+			var d float64
+			switch linkage {
+			case "single":
+				d = math.Min(dist[mi][k], dist[mj][k])
+			case "complete":
+				d = math.Max(dist[mi][k], dist[mj][k])
+			case "average":
+				d = (float64(a.size)*dist[mi][k] + float64(b.size)*dist[mj][k]) / float64(a.size+b.size)
+			default:
+				panic("victor: unknown linkage " + linkage)
+			}
+			dist[mi][k] = d
+			dist[k][mi] = d
+		}
+		nodes[mi] = &tree{left: a, right: b, height: min, size: a.size + b.size}
+
+		// Remove mj by moving the last cluster into its place.
+		last := len(nodes) - 1
+		nodes[mj] = nodes[last]
+		dist[mj] = dist[last]
+		for k := range dist {
+			dist[k][mj] = dist[k][last]
+			dist[k] = dist[k][:last]
+		}
+		nodes = nodes[:last]
+		dist = dist[:last]
+	}
+
+	return nodes[0]
+}
+
+// writeNewick writes the dendrogram rooted at t to the named file in
+// Newick format with family IDs as leaf names and branch lengths given
+// by the difference in merge heights.
+func writeNewick(file string, t *tree) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q Newick output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	if t != nil {
+		newick(b, t)
+	}
+	_, err = fmt.Fprintln(b, ";")
+	if err != nil {
+		log.Printf("failed to write Newick: %v", err)
+	}
+}
+
+// newick writes the Newick representation of t to w.
+func newick(w io.Writer, t *tree) {
+	if t.left == nil {
+		fmt.Fprint(w, t.id)
+		return
+	}
+	fmt.Fprint(w, "(")
+	newick(w, t.left)
+	fmt.Fprintf(w, ":%v,", t.height-t.left.height)
+	newick(w, t.right)
+	fmt.Fprintf(w, ":%v)", t.height-t.right.height)
+}
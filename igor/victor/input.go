@@ -0,0 +1,344 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/seq"
+
+	"github.com/biogo/examples/igor/victor/victor"
+)
+
+// openInput opens the named input. If name is "-" the input is read
+// from standard input, and if it is an http or https URL the input is
+// the body of the response to a GET request. Input that
+// starts with the gzip magic bytes is decompressed, and other input,
+// including uncompressed input with a .gz suffix, is read unaltered.
+func openInput(name string) (io.ReadCloser, error) {
+	rc, err := openRaw(name)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rc)
+	magic, _ := br.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return readCloser{Reader: br, Closer: rc}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return readCloser{Reader: gz, Closer: closers{gz, rc}}, nil
+}
+
+// openRaw opens the named input without decompression.
+func openRaw(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		return os.Open(name)
+	}
+	resp, err := http.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// readCloser is an io.ReadCloser composed of a reader and a closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closers is an io.Closer that closes each of its elements in order,
+// returning the first error.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for _, cl := range c {
+		if cerr := cl.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// familyScanner reads families held as igor JSON, one family per line,
+// so that each family may be processed as it is parsed rather than after
+// the whole input has been read. The index of each family is its line
+// number.
+type familyScanner struct {
+	r *bufio.Reader
+
+	index   int
+	members []victor.Feature
+	err     error
+}
+
+// newFamilyScanner returns a familyScanner reading from r.
+func newFamilyScanner(r io.Reader) *familyScanner {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &familyScanner{r: br, index: -1}
+}
+
+// Scan advances the scanner to the next family, which is then available
+// through Family. It returns false at the end of the input or on error.
+func (s *familyScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+	l, err := s.r.ReadBytes('\n')
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		return false
+	}
+	s.index++
+	var v []victor.Feature
+	err = json.Unmarshal(l, &v)
+	if err != nil {
+		s.err = fmt.Errorf("failed unmarshaling json for family %d: %v", s.index, err)
+		return false
+	}
+	s.members = v
+	return true
+}
+
+// Family returns the index and members of the family most recently
+// read by Scan.
+func (s *familyScanner) Family() (index int, members []victor.Feature) {
+	return s.index, s.members
+}
+
+// Err returns the first error encountered by Scan.
+func (s *familyScanner) Err() error {
+	return s.err
+}
+
+// isBEDHeader returns whether the BED line l is a track or browser line.
+func isBEDHeader(l []byte) bool {
+	if i := bytes.IndexAny(l, " \t"); i >= 0 {
+		l = l[:i]
+	}
+	return string(l) == "track" || string(l) == "browser"
+}
+
+// readBED returns the families held in r as BED and their names.
+// Features are grouped into families by the prefix of the name column
+// up to the first sep, and families are indexed in order of first
+// appearance. Strand is read from the sixth column if it is present.
+func readBED(r *bufio.Reader, sep string) (members [][]victor.Feature, names []string) {
+	familyOf := make(map[string]int)
+	for line := 1; ; line++ {
+		l, err := r.ReadBytes('\n')
+		if len(l) == 0 && err != nil {
+			break
+		}
+		l = bytes.TrimSpace(l)
+		if len(l) == 0 || l[0] == '#' || isBEDHeader(l) {
+			continue
+		}
+		fields := strings.Split(string(l), "\t")
+		if len(fields) < 4 {
+			fatalf(exitParse, "failed parsing bed line %d: need name column", line)
+		}
+		var f victor.Feature
+		f.Chr = fields[0]
+		f.Start, err = strconv.Atoi(fields[1])
+		if err != nil {
+			fatalf(exitParse, "failed parsing bed start on line %d: %v", line, err)
+		}
+		f.End, err = strconv.Atoi(fields[2])
+		if err != nil {
+			fatalf(exitParse, "failed parsing bed end on line %d: %v", line, err)
+		}
+		if len(fields) > 5 {
+			switch fields[5] {
+			case "+":
+				f.Orient = seq.Plus
+			case "-":
+				f.Orient = seq.Minus
+			}
+		}
+
+		name := fields[3]
+		if i := strings.Index(name, sep); i >= 0 {
+			name = name[:i]
+		}
+		i, ok := familyOf[name]
+		if !ok {
+			i = len(members)
+			familyOf[name] = i
+			members = append(members, nil)
+			names = append(names, name)
+		}
+		members[i] = append(members[i], f)
+	}
+	return members, names
+}
+
+// readGenome returns the chromosome lengths held in the named file as a
+// table of whitespace separated chromosome name and length pairs.
+func readGenome(file string) (map[string]int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	chromLen := make(map[string]int)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("missing length on line %d", line)
+		}
+		chromLen[fields[0]], err = strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid length on line %d: %v", line, err)
+		}
+	}
+	return chromLen, sc.Err()
+}
+
+// clip clips the features in v to the chromosome lengths in chromLen,
+// removing features that lie entirely outside their chromosome. Features
+// on chromosomes absent from chromLen are not altered. It returns the
+// kept features and the number of features clipped or removed.
+func clip(v []victor.Feature, chromLen map[string]int) ([]victor.Feature, int) {
+	var n int
+	kept := v[:0]
+	for _, f := range v {
+		end, ok := chromLen[f.Chr]
+		if !ok {
+			kept = append(kept, f)
+			continue
+		}
+		if f.Start < 0 || f.End > end {
+			n++
+			f.Start = max(f.Start, 0)
+			f.End = min(f.End, end)
+		}
+		if f.Start < f.End {
+			kept = append(kept, f)
+		}
+	}
+	return kept, n
+}
+
+// checkFeature returns an error describing why f is not a valid
+// feature, or nil if it is valid. Valid features have a non-negative
+// start before their end.
+func checkFeature(f victor.Feature) error {
+	switch {
+	case f.Chr == "":
+		return errors.New("empty chromosome name")
+	case f.Start < 0:
+		return errors.New("negative start")
+	case f.End <= f.Start:
+		return errors.New("end not after start")
+	case f.Weight != nil && *f.Weight < 0:
+		return errors.New("negative weight")
+	}
+	return nil
+}
+
+// normalizeFamily returns a copy of v sorted by chromosome, strand and
+// start with overlapping features on the same chromosome and strand
+// merged, and the number of features that were merged into another.
+// The ID and Weight of merged features are not retained.
+func normalizeFamily(v []victor.Feature) ([]victor.Feature, int) {
+	sorted := make([]victor.Feature, len(v))
+	copy(sorted, v)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Chr != b.Chr {
+			return a.Chr < b.Chr
+		}
+		if a.Orient != b.Orient {
+			return a.Orient < b.Orient
+		}
+		return a.Start < b.Start
+	})
+	var n int
+	merged := sorted[:0]
+	for _, f := range sorted {
+		if len(merged) != 0 {
+			last := &merged[len(merged)-1]
+			if last.Chr == f.Chr && last.Orient == f.Orient && f.Start < last.End {
+				last.End = max(last.End, f.End)
+				last.ID = ""
+				last.Weight = nil
+				n++
+				continue
+			}
+		}
+		merged = append(merged, f)
+	}
+	return merged, n
+}
+
+// binned returns a copy of v with each feature widened to the
+// enclosing boundaries of bins of the given size.
+func binned(v []victor.Feature, size int) []victor.Feature {
+	b := make([]victor.Feature, len(v))
+	for i, f := range v {
+		f.Start = f.Start / size * size
+		f.End = (f.End + size - 1) / size * size
+		b[i] = f
+	}
+	return b
+}
+
+// splitStrands returns the members of a family, v, split by strand into
+// plus and minus strand families. Members with unspecified strand are
+// placed with the plus strand members. When families are split family i
+// becomes families 2i (plus) and 2i+1 (minus).
+func splitStrands(v []victor.Feature) (plus, minus []victor.Feature) {
+	for _, f := range v {
+		if f.Orient == seq.Minus {
+			minus = append(minus, f)
+		} else {
+			plus = append(plus, f)
+		}
+	}
+	return plus, minus
+}
+
+// splitNames returns the names of the plus and minus strand families
+// split from the family with the given name by adding a strand suffix.
+// Unnamed families remain unnamed.
+func splitNames(name string) (plus, minus string) {
+	if name == "" {
+		return "", ""
+	}
+	return name + "(+)", name + "(-)"
+}
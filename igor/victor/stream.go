@@ -0,0 +1,52 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/biogo/examples/igor/victor/victor"
+)
+
+// edgeStream writes edges to a writer as they are found, so that a
+// downstream process may consume them while victor is still running.
+type edgeStream struct {
+	w io.Writer
+
+	// format is the stream format,
+	// json or tsv.
+	format string
+}
+
+// edgeRecord is the JSON representation of an edge in an edge stream.
+type edgeRecord struct {
+	From   int64   `json:"from"`
+	To     int64   `json:"to"`
+	Weight float64 `json:"weight"`
+}
+
+// write writes e to the stream as a JSON object or a tab-delimited
+// line. Each edge is written with a single call to the underlying
+// writer, so an unbuffered writer delivers edges as they are found.
+func (s *edgeStream) write(e victor.Edge) error {
+	var b []byte
+	switch s.format {
+	case "json":
+		var err error
+		b, err = json.Marshal(edgeRecord{From: e.F.ID(), To: e.T.ID(), Weight: e.W})
+		if err != nil {
+			return err
+		}
+		b = append(b, '\n')
+	case "tsv":
+		b = []byte(fmt.Sprintf("%d\t%d\t%v\n", e.F.ID(), e.T.ID(), e.W))
+	default:
+		panic("victor: unknown edge stream format " + s.format)
+	}
+	_, err := s.w.Write(b)
+	return err
+}
@@ -0,0 +1,234 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+	"gonum.org/v1/gonum/graph/topo"
+
+	"github.com/biogo/examples/igor/victor/victor"
+)
+
+// thresholds returns the thresholds described by a lo,hi,step range.
+func thresholds(r string) ([]float64, error) {
+	f := strings.Split(r, ",")
+	if len(f) != 3 {
+		return nil, errors.New("range must be lo,hi,step")
+	}
+	var v [3]float64
+	for i, s := range f {
+		var err error
+		v[i], err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	lo, hi, step := v[0], v[1], v[2]
+	if step <= 0 || lo > hi {
+		return nil, errors.New("range must have lo <= hi and positive step")
+	}
+	if lo < 0 || hi > 1 {
+		return nil, errors.New("range must lie within [0,1]")
+	}
+	var t []float64
+	for i := 0; ; i++ {
+		// Allow for accumulated rounding error at hi.
+		v := lo + float64(i)*step
+		if v > hi+step*1e-9 {
+			break
+		}
+		t = append(t, v)
+	}
+	return t, nil
+}
+
+// writeSweep writes the number of edges, connected components, the size
+// of the largest component and the number of cliques of at least
+// minClique members in the family graph found by c from pairs for each
+// threshold in thresh to w. The kind of components counted is as for
+// components, and families without edges are counted as singleton
+// components as for summarize.
+func writeSweep(w io.Writer, c *victor.Connector, fams []victor.Family, pairs []victor.Similarity, thresh []float64, minClique int, kind string) {
+	b := bufio.NewWriter(w)
+	defer b.Flush()
+	_, err := fmt.Fprintln(b, "thresh\tedges\tcomponents\tlargest\tcliques")
+	if err != nil {
+		log.Printf("failed to write sweep: %v", err)
+		return
+	}
+	for _, t := range thresh {
+		edges := c.EdgesFrom(fams, pairs, t)
+
+		g := simple.NewUndirectedGraph()
+		for _, e := range edges {
+			for _, n := range []graph.Node{e.From(), e.To()} {
+				if !g.Has(n) {
+					g.AddNode(n)
+				}
+			}
+			g.SetEdge(e)
+		}
+		n, _, largest := componentCounts(fams, edges, kind)
+		var cliques int
+		for _, c := range topo.BronKerbosch(g) {
+			if len(c) >= minClique {
+				cliques++
+			}
+		}
+
+		_, err = fmt.Fprintf(b, "%.6g\t%d\t%d\t%d\t%d\n", t, len(edges), n, largest, cliques)
+		if err != nil {
+			log.Printf("failed to write sweep: %v", err)
+			return
+		}
+	}
+}
+
+// histogram returns the counts of the upper intersection, or of the
+// composite weight if comp is not nil, of the intersecting pairs in
+// pairs in n equal width bins over [0,1], with values of at least 1
+// counted in the last bin. It also returns the number of pairs with a
+// value greater than or equal to thresh.
+func histogram(pairs []victor.Similarity, n int, comp victor.Composite, thresh float64) (counts []int, passed int) {
+	counts = make([]int, n)
+	for _, p := range pairs {
+		v := p.Upper
+		if comp != nil {
+			v = comp.Weight(victor.MetricsOf(p.Upper, p.Lower))
+		}
+		if v >= thresh {
+			passed++
+		}
+		i := int(v * float64(n))
+		switch {
+		case i < 0:
+			i = 0
+		case i >= n:
+			i = n - 1
+		}
+		counts[i]++
+	}
+	return counts, passed
+}
+
+// writePairStats writes a histogram of the pairs in pairs with n bins,
+// as described for histogram, to w followed by the number of pairs that
+// pass thresh.
+func writePairStats(w io.Writer, pairs []victor.Similarity, n int, comp victor.Composite, thresh float64) {
+	counts, passed := histogram(pairs, n, comp, thresh)
+	fmt.Fprintln(w, "pair similarity histogram:")
+	for i, c := range counts {
+		fmt.Fprintf(w, "\t[%.3g,%.3g)\t%d\n", float64(i)/float64(n), float64(i+1)/float64(n), c)
+	}
+	fmt.Fprintf(w, "%d of %d intersecting pairs pass threshold %v\n", passed, len(pairs), thresh)
+}
+
+// writeHistogram writes a histogram of the pairs in pairs with n bins,
+// as described for histogram, to the named file.
+func writeHistogram(file string, pairs []victor.Similarity, n int, comp victor.Composite) {
+	counts, _ := histogram(pairs, n, comp, math.Inf(1))
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q histogram output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	_, err = fmt.Fprintln(b, "lo\thi\tpairs")
+	if err != nil {
+		log.Printf("failed to write histogram: %v", err)
+		return
+	}
+	for i, c := range counts {
+		_, err = fmt.Fprintf(b, "%.6g\t%.6g\t%d\n", float64(i)/float64(n), float64(i+1)/float64(n), c)
+		if err != nil {
+			log.Printf("failed to write histogram: %v", err)
+			return
+		}
+	}
+}
+
+// summary holds the statistics of a clustering run.
+type summary struct {
+	Families      int `json:"families"`
+	Components    int `json:"components"`
+	Singletons    int `json:"singletons"`
+	Largest       int `json:"largest"`
+	Cliques       int `json:"cliques"`
+	CliqueMembers int `json:"clique_members"`
+}
+
+// components returns the strongly connected components of the directed
+// graph of edges if kind is "strong", and otherwise its weakly connected
+// components. Families without edges are not included.
+func components(edges []victor.Edge, kind string) [][]graph.Node {
+	if kind == "strong" {
+		return topo.TarjanSCC(victor.Directed(edges, nil, 0, 0))
+	}
+	return topo.ConnectedComponents(victor.Undirected(edges, nil))
+}
+
+// summarize returns the number of families, connected components,
+// singleton families, the size of the largest component, the number of
+// cliques and the number of families in cliques of a clustering run. The
+// kind of components counted is as for components.
+func summarize(fams []victor.Family, edges []victor.Edge, grps []victor.Group, cliqueMemberships map[int64]int64, kind string) summary {
+	var sum summary
+	sum.Components, sum.Singletons, sum.Largest = componentCounts(fams, edges, kind)
+	for _, grp := range grps {
+		if grp.IsClique {
+			sum.Cliques++
+		}
+		sum.Cliques += len(grp.Cliques)
+	}
+	for _, n := range cliqueMemberships {
+		if n != 0 {
+			sum.CliqueMembers++
+		}
+	}
+	sum.Families = len(fams)
+	return sum
+}
+
+// componentCounts returns the number of components of the family graph
+// of fams and edges, counting each family without edges as a singleton
+// component, the number of singletons and the size of the largest
+// component. The kind of components counted is as for components.
+func componentCounts(fams []victor.Family, edges []victor.Edge, kind string) (n, singletons, largest int) {
+	cc := components(edges, kind)
+	for _, c := range cc {
+		if len(c) > largest {
+			largest = len(c)
+		}
+	}
+	singletons = len(fams) - len(victor.Undirected(edges, nil).Nodes())
+	if singletons != 0 && largest == 0 {
+		largest = 1
+	}
+	return len(cc) + singletons, singletons, largest
+}
+
+// writeSummary writes the statistics in sum to w, one per line.
+func writeSummary(w io.Writer, sum summary) {
+	fmt.Fprintf(w, "families=%d\n", sum.Families)
+	fmt.Fprintf(w, "components=%d\n", sum.Components)
+	fmt.Fprintf(w, "singletons=%d\n", sum.Singletons)
+	fmt.Fprintf(w, "largest=%d\n", sum.Largest)
+	fmt.Fprintf(w, "cliques=%d\n", sum.Cliques)
+	fmt.Fprintf(w, "clique-members=%d\n", sum.CliqueMembers)
+}
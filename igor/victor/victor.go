@@ -3,47 +3,375 @@
 // license that can be found in the LICENSE file.
 
 // victor is a post processor for grouping families defined by igor.
+//
+// The cluster command, which is run when no command is given, groups
+// families and writes annotated GFF. The stats command writes summary
+// statistics of the family graph instead, and the convert command writes
+// the input families as GFF, and BED if -bed is given, without comparing
+// them. Each command accepts only the flags that apply to it; run a
+// command with -help to list them.
+//
+// The Clique GFF attribute identifies the clique within a cluster that a
+// family belongs to. When -weighted-cliques is used only the cliques with
+// the greatest summed edge weight in each cluster are retained, so the
+// attribute marks membership of the most strongly overlapping set of
+// families rather than of any maximal clique. A family that is a member
+// of more than one clique is labelled with a single clique followed by
+// "*"; with -all-cliques such families also receive a Cliques attribute
+// listing every clique they belong to and an Ambiguous=true attribute.
+//
+// Overlap between families on opposite strands contributes to their
+// intersection in proportion to -strand-penalty. The default penalty of 1
+// ignores strand; -orient sets the penalty to 0 so only strand-matched
+// overlap contributes to the upper and lower intersections, and cannot be
+// combined with an explicit -strand-penalty. Members with
+// an unspecified strand agree with both strands when -unknown-strand is
+// "both" and with neither when it is "none", so in the latter case their
+// overlap is always subject to the penalty.
+//
+// By default an edge's weight is the intersection as a fraction of the
+// shorter family and, when the fraction of the longer family also passes
+// the threshold, a reciprocal edge is added. The -metric-weights option
+// instead gives a single edge a weight that is a sum of weighted metrics,
+// written as terms of the form coef*metric separated by "+", where the
+// metric is upper (fraction of the shorter family), lower (fraction of
+// the longer family) or jaccard (fraction of the union) and the
+// coefficient defaults to 1; for example "0.7*upper+0.3*jaccard". The
+// threshold then applies to the composite weight. The -metric jaccard
+// option is a shorthand for "-metric-weights jaccard", joining each pair
+// of families by a single edge weighted by the Jaccard index, the
+// intersection over the union of their coverage, when it passes the
+// threshold.
+//
+// With -reciprocal, families are only joined when the intersection as a
+// fraction of the longer family, and so of both families, passes the
+// threshold. Each such pair is joined by a single edge from the shorter
+// family to the longer weighted by that fraction instead of a pair of
+// directed edges, so the graph is effectively undirected and the edge
+// weight is the reciprocal overlap. Pairs that pass the threshold only
+// as a fraction of the shorter family, which are joined by a single
+// directed edge by default, are not joined.
+//
+// With -collapse, the pair of reciprocal edges is likewise replaced by a
+// single edge from the shorter family to the longer with the mean or
+// minimum of the two weights. Clustering ignores edge direction, but the
+// PageRank used to rank members and choose cluster representatives is
+// calculated over the directed graph, so under -collapse or -reciprocal
+// the longer family of each such pair no longer links back to the shorter
+// and representatives may differ from those of the default graph.
+//
+// The -thresh-percentile option sets the threshold to the given
+// percentile of the weights compared with the threshold, the upper,
+// lower or composite weight as described above, over intersecting family
+// pairs. Pairs that do not intersect are not included.
+//
+// Clusters are not connected components. With the default -cluster-method
+// of louvain they are the communities of greatest modularity, at the given
+// -resolution, of the family graph with edge direction ignored, so a single
+// weak edge between two densely connected sets of families does not merge
+// them. The Cluster attribute identifies the community and cliques are
+// found within each community as described above.
+//
+// The components and largest statistics reported by the stats command and
+// -sweep count the weakly connected components of the family graph by
+// default, grouping families reachable from each other ignoring edge
+// direction. With -components strong they count strongly connected
+// components, grouping only families that are mutually reachable along
+// directed edges, which better suits containment relationships. Clusters
+// are found by -cluster-method in either case.
+//
+// The -pair-stats option adds a histogram of pair similarities and the
+// number of pairs passing the threshold to the graph statistics written
+// by either command. It is named for the pairs it describes rather than
+// -stats so that it is not mistaken for a way to select the stats
+// command, which is chosen by the first argument.
+//
+// Family pairs are compared in parallel by -threads workers, for which
+// -procs is an alias, defaulting to the number of CPUs available. Edges
+// are collected in comparison order so output does not depend on the
+// number of workers.
+//
+// Flags not given on the command line may be set from the environment.
+// The variable for a flag is its name in upper case with hyphens replaced
+// by underscores and prefixed with VICTOR_, so -thresh is set by
+// VICTOR_THRESH and -split-strand by VICTOR_SPLIT_STRAND. Flags may also
+// be given in a JSON file named by -config holding an object that maps
+// flag names to values; values from the command line and environment take
+// precedence over those in the file, and the file may only name flags
+// accepted by the command being run.
+//
+// victor exits with status 0 on success, 1 on a failure during analysis
+// or output, 2 for invalid flags or parameters, 3 when an input file
+// cannot be opened, 4 when an input file cannot be parsed and 5 when the
+// input holds no families after filtering.
 package main
 
 import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
-	"math/rand"
 	"os"
+	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"sort"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/biogo/biogo/io/featio/gff"
 	"github.com/biogo/biogo/seq"
-	"github.com/biogo/store/step"
 
 	"gonum.org/v1/gonum/graph"
-	"gonum.org/v1/gonum/graph/community"
 	"gonum.org/v1/gonum/graph/encoding"
 	"gonum.org/v1/gonum/graph/encoding/dot"
-	"gonum.org/v1/gonum/graph/network"
 	"gonum.org/v1/gonum/graph/simple"
 	"gonum.org/v1/gonum/graph/topo"
+
+	"github.com/biogo/examples/igor/victor/victor"
 )
 
 var (
-	in         = flag.String("in", "", "Specifies the input json file name.")
+	metaOut    = flag.String("meta-out", "", "Specifies the output JSON file name for run metadata.")
+	config     = flag.String("config", "", "Specifies a JSON file of flag values; flags given on the command line or in the environment take precedence.")
+	in         = flag.String("in", "", "Specifies a comma-separated list of input json file names or http(s) URLs, optionally gzip compressed (if - read from stdin); families are numbered in input order.")
+	inAttr     = flag.Bool("input-attr", false, "Include an Input GFF attribute naming the input each family was read from.")
+	inFormat   = flag.String("in-format", "json", "Specifies the input format (json or bed).")
+	genome     = flag.String("genome", "", "Specifies a chromosome length table used to clip features.")
+	covAttr    = flag.Bool("coverage-attr", false, "Include a Coverage GFF attribute giving family length over genomic span.")
+	confAttr   = flag.Bool("confidence-attr", false, "Include a Confidence GFF attribute giving the mean edge weight from a family to the other members of its cluster.")
+	coreAttr   = flag.Bool("kcore", false, "Include a Core GFF attribute giving the k-core number of each clustered family within its cluster.")
+	rawLength  = flag.Bool("raw-length", false, "Include RawLength and SelfOverlap GFF attributes giving summed member length and its ratio to family length.")
+	covOut     = flag.String("coverage-out", "", "Specifies the output file name for the per-chromosome coverage report.")
+	bedNameSep = flag.String("bed-name-sep", ".", "Specifies the separator ending the family prefix of BED names.")
 	dotOut     = flag.String("dot", "", "Specifies the output DOT file name.")
+	dotEngine  = flag.String("dot-layout", "", "Specifies a Graphviz layout engine such as sfdp to name in the DOT output, with node overlap disabled.")
+	sccOut     = flag.String("condensation-out", "", "Specifies the output DOT file name for the graph of strongly connected components of families.")
+	dotDir     = flag.String("dot-per-component", "", "Specifies a directory to write a DOT file for each cluster to.")
+	dotAll     = flag.Bool("dot-all", false, "Include families without edges as isolated nodes in the DOT output.")
+	dotUndir   = flag.Bool("dot-undirected", false, "Write the DOT output as an undirected graph with one edge per connected pair.")
+	graphML    = flag.String("graphml", "", "Specifies the output GraphML file name; -dot-all and -dot-undirected apply as for the DOT output.")
+	dotPrec    = flag.Int("dot-prec", -1, "Specifies the number of significant figures for DOT edge weights (if -1 use the fewest that represent the weight exactly).")
+	gffOut     = flag.String("out", "", "Specifies the output GFF file name (if empty write to stdout).")
+	gffSource  = flag.String("gff-source", "igor/victor", "Specifies the GFF source field.")
+	gffType    = flag.String("gff-type", "repeat", "Specifies the GFF feature type field.")
+	sortBy     = flag.String("sort", "", "Specifies GFF output order (position or cluster); sorting holds all output features in memory.")
+	splitChrom = flag.String("split-chrom", "", "Specifies a directory to write a position sorted GFF file for each chromosome to.")
+	clusterGFF = flag.String("gff-per-cluster", "", "Specifies a directory to write a GFF file for each cluster to.")
+	jsonlOut   = flag.String("jsonl-out", "", "Specifies the output JSON Lines file name for per-family annotations, written once all families are grouped.")
+	repsOut    = flag.String("reps-out", "", "Specifies the output file name for cluster representatives and their members in PageRank order.")
+	summOut    = flag.String("summary", "", "Specifies the output JSON file name for a summary of each group's members, sub-cliques and PageRanks.")
+	clustOut   = flag.String("clusters", "", "Specifies the output TSV file name for per-cluster family, member and coverage counts.")
+	cliqueCnt  = flag.String("clique-counts-out", "", "Specifies the output TSV file name for the number of cliques each family is a member of.")
+	bedOut     = flag.String("bed", "", "Specifies the output BED file name; coordinates are 0-based half-open.")
+	bedCols    = flag.Int("bed-columns", 9, "Specifies the number of BED output columns (6 or 9).")
+	trackLine  = flag.Bool("track-line", false, "Prepend a UCSC track line to the BED output.")
+	pairsOut   = flag.String("pairs-out", "", "Specifies the output TSV file name for pairwise family intersections.")
+	edgesCSV   = flag.String("edges", "", "Specifies the output CSV file name for the intersections and lengths of family pairs with an upper intersection of at least -thresh.")
+	pairsRaw   = flag.Bool("pairs-raw", false, "Include a raw_bp column in -pairs-out giving overlap summed over all pairs of members.")
+	pairsMin   = flag.Float64("pairs-min", 0, "Specifies the upper intersection a pair must exceed to be written to -pairs-out.")
+	laplacian  = flag.String("laplacian-out", "", "Specifies the output Matrix Market file name for the weighted graph Laplacian.")
+	adjOut     = flag.String("matrix", "", "Specifies the output Matrix Market file name for the weighted adjacency matrix of the family graph.")
+	distOut    = flag.String("dist-out", "", "Specifies the output file name for the condensed family distance matrix of one minus the edge weight.")
+	newickOut  = flag.String("newick-out", "", "Specifies the output Newick file name for hierarchical clustering of families.")
+	linkage    = flag.String("linkage", "average", "Specifies the hierarchical clustering linkage (single, complete or average).")
+	bedpeOut   = flag.String("bedpe-out", "", "Specifies the output BEDPE file name for family edges.")
+	scoreScale = flag.String("score-scale", "none", "Specifies PageRank to score scaling within clusters (none, linear or log).")
+	scoreBy    = flag.String("score", "", "Specifies the metric written to GFF and BED score columns (pagerank, maxedge or none); pagerank is scaled by -score-scale, or linearly if it is none (if empty use pagerank when -score-scale is not none).")
 	thresh     = flag.Float64("thresh", 0.05, "Specifies minimum family intersection to report.")
+	threshLow  = flag.Float64("thresh-lower", -1, "Specifies the minimum lower intersection for a reciprocal edge (if -1 use -thresh).")
+	sweep      = flag.String("sweep", "", "Specifies a lo,hi,step threshold range to report clustering statistics for instead of writing GFF.")
+	histOut    = flag.String("hist-out", "", "Specifies the output TSV file name for a histogram of pair similarities before thresholding.")
+	histBins   = flag.Int("hist-bins", 20, "Specifies the number of -hist-out and -pair-stats histogram bins.")
+	pairStats  = flag.Bool("pair-stats", false, "Write a histogram of pair similarities and the number of pairs passing -thresh with the graph statistics.")
+	approx     = flag.Bool("approx", false, "Connect families by MinHash estimates of the Jaccard index of their binned coverage instead of exact intersection; pair outputs and edge metric options are not available.")
+	approxK    = flag.Int("approx-hashes", 128, "Specifies the MinHash signature length for -approx.")
+	approxBin  = flag.Int("approx-bin", 100, "Specifies the genomic bin width in bases for -approx and -lsh-bands.")
+	lshBands   = flag.Int("lsh-bands", 0, "Specifies the number of MinHash bands used to choose candidate pairs for comparison (if 0 compare all pairs).")
+	lshRows    = flag.Int("lsh-rows", 4, "Specifies the number of MinHash rows in each -lsh-bands band.")
+	edgeMetric = flag.String("metric", "upper", "Specifies the edge weight metric (upper or jaccard); jaccard is equivalent to -metric-weights jaccard.")
+	metricWts  = flag.String("metric-weights", "", "Specifies a composite edge weight such as 0.7*upper+0.3*jaccard (see package documentation).")
+	collapse   = flag.String("collapse", "", "Specifies how reciprocal edges are combined into a single edge (mean or min); if empty both directed edges are kept.")
+	reciprocal = flag.Bool("reciprocal", false, "Only join families whose intersection passes the threshold as a fraction of both families, with a single edge.")
+	threshPct  = flag.Float64("thresh-percentile", 0, "Specifies the percentile of the edge weights of intersecting pairs to use as the threshold; pairs that do not intersect are excluded (if 0 use -thresh).")
+	compKind   = flag.String("components", "weak", "Specifies whether component statistics count weakly or strongly connected components (weak or strong).")
+	clustMeth  = flag.String("cluster-method", "louvain", "Specifies the clustering method (louvain or label-propagation).")
+	seed       = flag.Int64("seed", 1, "Specifies the seed for all randomised steps.")
+	damping    = flag.Float64("pagerank-damping", 0.85, "Specifies the PageRank damping factor in (0,1) used to rank cluster members.")
+	pageTol    = flag.Float64("pagerank-tol", 1e-6, "Specifies the PageRank convergence tolerance used to rank cluster members.")
 	resolution = flag.Float64("resolution", 1, "Specifies the resolution for cluster modularisation.")
+	splitStr   = flag.Bool("split-strand", false, "Split families by member strand before comparison; family i becomes families 2i (plus) and 2i+1 (minus).")
+	unknown    = flag.String("unknown-strand", "both", "Specifies whether unspecified strand members agree with both or none of the strands.")
+	orient     = flag.Bool("orient", false, "Count only strand-matched overlap towards intersection; equivalent to -strand-penalty 0.")
+	strandPen  = flag.Float64("strand-penalty", 1, "Specifies the multiplier in [0,1] for intersection contributed by opposite strand overlaps.")
+	binSize    = flag.Int("bin-size", 1, "Specifies the bin width in bases that feature coordinates are widened to before calculating coverage.")
+	snapOut    = flag.Bool("snap-output", false, "Write binned rather than input coordinates when -bin-size is greater than 1.")
+	bitset     = flag.Bool("bitset", false, "Calculate intersections with bitsets; used automatically when the -genome total is small.")
+	weighted   = flag.Bool("weighted", false, "Weight family coverage by per-feature W weights; features without a W weight have a weight of 1 and negative weights are invalid.")
+	selfWarn   = flag.Bool("warn-self-overlap", false, "Log families whose members overlap each other on the same strand.")
+	skipBad    = flag.Bool("skip-invalid", false, "Drop features with an empty chromosome name, a negative start, an end not after their start or a negative weight instead of failing.")
 	minFam     = flag.Int("min", 0, "Specify the minimum number of members in a family to include (if 0 no limit).")
+	allCliques = flag.Bool("all-cliques", false, "List all cliques of families in more than one clique in GFF Cliques and Ambiguous attributes.")
 	cliques    = flag.Bool("cliques", false, "Find cliques in non-clique clusters.")
-	threads    = flag.Int("threads", 0, "Specify the number of parallel connection threads (if 0 use GOMAXPROCS).")
+	minClust   = flag.Int("mincluster", 0, "Specifies the minimum number of members of a cluster; families in smaller clusters are written unclustered (if 0 no limit).")
+	subClique  = flag.Int("minclique", 3, "Specifies the minimum number of members of cliques found in non-clique clusters (at least 2).")
+	percolate  = flag.Int("percolation", 0, "Specifies k for k-clique percolation communities within clusters (if 0 no percolation).")
+	wCliques   = flag.Bool("weighted-cliques", false, "Report only the maximum-weight cliques in non-clique clusters.")
+	edgeFmt    = flag.String("edge-stream", "", "Specifies a format (json or tsv) to stream edges in as they are found; if empty edges are not streamed.")
+	streamOut  = flag.String("edge-stream-out", "", "Specifies the file name, which may be a named pipe, for -edge-stream (if empty use stderr).")
+	logFile    = flag.String("log", "", "Specifies a file to write diagnostic output to instead of stderr.")
+	quiet      = flag.Bool("quiet", false, "Suppress diagnostic output, leaving only errors.")
+	showVer    = flag.Bool("version", false, "Print the victor version and the igor JSON schema version and exit.")
+	threads    = flag.Int("threads", 0, "Specify the number of parallel connection threads (if 0 use GOMAXPROCS, which defaults to the number of CPUs); output does not depend on the number of threads.")
+)
+
+func init() {
+	// -procs is an alias of -threads.
+	flag.Var(flag.Lookup("threads").Value, "procs", "Alias of -threads.")
+}
+
+// Flag groups. Every flag is defined on flag.CommandLine and each
+// command parses a flag set holding only the flags of its groups.
+var (
+	// inputFlags control reading and filtering the input families.
+	inputFlags = []string{
+		"config", "in", "in-format", "bed-name-sep", "genome", "coverage-out",
+		"split-strand", "bin-size", "skip-invalid", "warn-self-overlap", "min",
+		"log", "quiet", "version",
+	}
+
+	// compareFlags control family comparison and the family graph.
+	compareFlags = []string{
+		"thresh", "thresh-lower", "thresh-percentile", "sweep", "hist-out",
+		"hist-bins", "pair-stats", "approx", "approx-hashes", "approx-bin",
+		"lsh-bands", "lsh-rows", "metric", "metric-weights", "collapse",
+		"reciprocal", "orient", "strand-penalty", "unknown-strand", "bitset",
+		"weighted", "threads", "procs", "edge-stream", "edge-stream-out", "pairs-out",
+		"pairs-raw", "pairs-min", "edges", "dist-out", "newick-out", "linkage",
+		"components",
+	}
+
+	// groupFlags control clustering and ranking of families.
+	groupFlags = []string{
+		"cluster-method", "seed", "resolution", "minclique", "cliques",
+		"weighted-cliques", "percolation", "mincluster", "pagerank-damping",
+		"pagerank-tol",
+	}
+
+	// featureFlags control GFF and BED output of family members.
+	featureFlags = []string{
+		"out", "gff-source", "gff-type", "sort", "snap-output", "input-attr",
+		"coverage-attr", "raw-length", "bed", "bed-columns", "track-line",
+	}
+
+	// clusterFlags control output only written by the cluster command.
+	clusterFlags = []string{
+		"meta-out", "all-cliques", "confidence-attr", "kcore", "score",
+		"score-scale", "split-chrom", "gff-per-cluster", "jsonl-out", "reps-out",
+		"summary", "clusters", "clique-counts-out", "laplacian-out", "matrix",
+		"dot", "dot-layout", "dot-prec", "dot-all", "dot-undirected", "graphml",
+		"condensation-out", "dot-per-component", "bedpe-out",
+	}
+)
+
+// commands holds the flag groups accepted by each command.
+var commands = map[string][][]string{
+	"cluster": {inputFlags, compareFlags, groupFlags, featureFlags, clusterFlags},
+	"stats":   {inputFlags, compareFlags, groupFlags},
+	"convert": {inputFlags, featureFlags},
+}
+
+// commandFlags returns a flag set for the named command holding the
+// flags of its groups. The flags share their values with flag.CommandLine.
+func commandFlags(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	for _, group := range commands[cmd] {
+		for _, name := range group {
+			f := flag.Lookup(name)
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [cluster|stats|convert] [flags]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "flags for %s:\n", cmd)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// version is the victor build version. It may be set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3"
+//
+// and is otherwise taken from the module build information.
+var version string
+
+// schemaVersion is the version of the igor JSON family format read by
+// victor.
+const schemaVersion = 1
+
+// buildVersion returns the victor build version.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// Exit statuses.
+const (
+	exitInternal = 1 // Failure during analysis or output.
+	exitUsage    = 2 // Invalid flags or parameters.
+	exitNotFound = 3 // An input file could not be opened.
+	exitParse    = 4 // An input file could not be parsed.
+	exitEmpty    = 5 // The input holds no families.
 )
 
+// fatalf logs the formatted message and exits with the given status.
+func fatalf(status int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(status)
+}
+
 func main() {
-	flag.Parse()
+	start := time.Now()
+
+	cmd := "cluster"
+	args := os.Args[1:]
+	if len(args) != 0 {
+		if _, ok := commands[args[0]]; ok {
+			cmd, args = args[0], args[1:]
+		}
+	}
+	fs := commandFlags(cmd)
+	flag.Usage = fs.Usage
+	fs.Parse(args)
+	if *showVer {
+		fmt.Printf("victor %s (igor JSON schema %d)\n", buildVersion(), schemaVersion)
+		os.Exit(0)
+	}
+	err := setFromEnv(fs)
+	if err != nil {
+		fatalf(exitUsage, "error: %v", err)
+	}
+	if *config != "" {
+		err = setFromConfig(fs, *config)
+		if os.IsNotExist(err) {
+			fatalf(exitNotFound, "error: %v", err)
+		}
+		if err != nil {
+			fatalf(exitUsage, "error: %v", err)
+		}
+	}
 	if *in == "" {
 		flag.Usage()
 		os.Exit(0)
@@ -51,84 +379,592 @@ func main() {
 	if *threads == 0 {
 		*threads = runtime.GOMAXPROCS(0)
 	}
+	switch *scoreScale {
+	case "none", "linear", "log":
+	default:
+		fatalf(exitUsage, "invalid score scale %q: must be none, linear or log", *scoreScale)
+	}
+	switch *scoreBy {
+	case "":
+		*scoreBy = "none"
+		if *scoreScale != "none" {
+			*scoreBy = "pagerank"
+		}
+	case "pagerank":
+		if *scoreScale == "none" {
+			*scoreScale = "linear"
+		}
+	case "maxedge", "none":
+	default:
+		fatalf(exitUsage, "invalid score %q: must be pagerank, maxedge or none", *scoreBy)
+	}
+	switch *clustMeth {
+	case "louvain", "label-propagation":
+	default:
+		fatalf(exitUsage, "invalid cluster method %q: must be louvain or label-propagation", *clustMeth)
+	}
+	switch *compKind {
+	case "weak", "strong":
+	default:
+		fatalf(exitUsage, "invalid component kind %q: must be weak or strong", *compKind)
+	}
+	if *bedCols != 6 && *bedCols != 9 {
+		fatalf(exitUsage, "invalid BED column count %d: must be 6 or 9", *bedCols)
+	}
+	switch *linkage {
+	case "single", "complete", "average":
+	default:
+		fatalf(exitUsage, "invalid linkage %q: must be single, complete or average", *linkage)
+	}
+	switch *inFormat {
+	case "json", "bed":
+	default:
+		fatalf(exitUsage, "invalid input format %q: must be json or bed", *inFormat)
+	}
+	if *damping <= 0 || *damping >= 1 {
+		fatalf(exitUsage, "invalid PageRank damping %v: must be in (0,1)", *damping)
+	}
+	if *pageTol <= 0 {
+		fatalf(exitUsage, "invalid PageRank tolerance %v: must be positive", *pageTol)
+	}
+	if *subClique < 2 {
+		fatalf(exitUsage, "invalid minimum clique size %d: must be at least 2", *subClique)
+	}
+	if *minClust < 0 {
+		fatalf(exitUsage, "invalid minimum cluster size %d: must not be negative", *minClust)
+	}
+	if *strandPen < 0 || *strandPen > 1 {
+		fatalf(exitUsage, "invalid strand penalty %v: must be in [0,1]", *strandPen)
+	}
+	if *orient {
+		var penSet bool
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "strand-penalty" {
+				penSet = true
+			}
+		})
+		if penSet {
+			fatalf(exitUsage, "invalid flags: -orient cannot be used with -strand-penalty")
+		}
+		*strandPen = 0
+	}
+	switch *sortBy {
+	case "", "position", "cluster":
+	default:
+		fatalf(exitUsage, "invalid sort order %q: must be position or cluster", *sortBy)
+	}
+	switch *unknown {
+	case "both", "none":
+	default:
+		fatalf(exitUsage, "invalid unknown strand handling %q: must be both or none", *unknown)
+	}
+	if *approx {
+		if *approxK < 1 {
+			fatalf(exitUsage, "invalid MinHash signature length %d: must be positive", *approxK)
+		}
+		if *approxBin < 1 {
+			fatalf(exitUsage, "invalid MinHash bin width %d: must be positive", *approxBin)
+		}
+		// Estimated similarities are not recorded as pairs and
+		// have no upper and lower intersections to combine.
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"thresh-percentile", *threshPct != 0},
+			{"thresh-lower", *threshLow != -1},
+			{"sweep", *sweep != ""},
+			{"pairs-out", *pairsOut != ""},
+			{"pairs-raw", *pairsRaw},
+			{"edges", *edgesCSV != ""},
+			{"dist-out", *distOut != ""},
+			{"newick-out", *newickOut != ""},
+			{"hist-out", *histOut != ""},
+			{"pair-stats", *pairStats},
+			{"metric", *edgeMetric != "upper"},
+			{"metric-weights", *metricWts != ""},
+			{"collapse", *collapse != ""},
+			{"reciprocal", *reciprocal},
+			{"weighted", *weighted},
+		} {
+			if f.set {
+				fatalf(exitUsage, "invalid flags: -approx cannot be used with -%s", f.name)
+			}
+		}
+	}
+	if *lshBands < 0 {
+		fatalf(exitUsage, "invalid LSH band count %d: must not be negative", *lshBands)
+	}
+	if *lshBands != 0 && *lshRows < 1 {
+		fatalf(exitUsage, "invalid LSH row count %d: must be positive", *lshRows)
+	}
+	if *binSize < 1 {
+		fatalf(exitUsage, "invalid bin size %d: must be positive", *binSize)
+	}
+	if *histBins < 1 {
+		fatalf(exitUsage, "invalid histogram bin count %d: must be positive", *histBins)
+	}
+	if *thresh < 0 || *thresh > 1 {
+		fatalf(exitUsage, "invalid threshold %v: must be in [0,1]", *thresh)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"source", *gffSource},
+		{"feature type", *gffType},
+	} {
+		if f.value == "" || strings.ContainsAny(f.value, "\t\n") {
+			fatalf(exitUsage, "invalid GFF %s %q: must be non-empty without tabs or newlines", f.name, f.value)
+		}
+	}
+	if *threshLow != -1 && (*threshLow < 0 || *threshLow > 1) {
+		fatalf(exitUsage, "invalid lower threshold %v: must be in [0,1] or -1 to use -thresh", *threshLow)
+	}
+	if *threshPct < 0 || *threshPct >= 100 {
+		fatalf(exitUsage, "invalid threshold percentile %v: must be in [0,100)", *threshPct)
+	}
+	var combine func(upper, lower float64) float64
+	switch *collapse {
+	case "":
+	case "mean":
+		combine = func(upper, lower float64) float64 { return (upper + lower) / 2 }
+	case "min":
+		combine = math.Min
+	default:
+		fatalf(exitUsage, "invalid collapse method %q: must be mean or min", *collapse)
+	}
+	switch *edgeMetric {
+	case "upper":
+	case "jaccard":
+		if *metricWts != "" {
+			fatalf(exitUsage, "invalid flags: -metric jaccard cannot be used with -metric-weights")
+		}
+		*metricWts = "jaccard"
+	default:
+		fatalf(exitUsage, "invalid metric %q: must be upper or jaccard", *edgeMetric)
+	}
+	if *reciprocal && (*collapse != "" || *metricWts != "") {
+		fatalf(exitUsage, "invalid flags: -reciprocal cannot be used with -collapse or -metric-weights")
+	}
+	var comp victor.Composite
+	if *metricWts != "" {
+		var err error
+		comp, err = victor.ParseComposite(*metricWts)
+		if err != nil {
+			fatalf(exitUsage, "invalid metric weights %q: %v", *metricWts, err)
+		}
+	}
+	var sweepRange []float64
+	if *sweep != "" {
+		var err error
+		sweepRange, err = thresholds(*sweep)
+		if err != nil {
+			fatalf(exitUsage, "invalid sweep %q: %v", *sweep, err)
+		}
+	}
 
-	f, err := os.Open(*in)
-	if err != nil {
-		log.Fatalf("failed reading %q: %v", *in, err)
+	var diag io.Writer = os.Stderr
+	switch {
+	case *quiet:
+		diag = io.Discard
+	case *logFile != "":
+		lf, err := os.Create(*logFile)
+		if err != nil {
+			fatalf(exitInternal, "failed to create log file %q: %v", *logFile, err)
+		}
+		defer lf.Close()
+		diag = lf
+	}
+
+	var stream func(victor.Edge)
+	switch *edgeFmt {
+	case "":
+	case "json", "tsv":
+		s := &edgeStream{w: os.Stderr, format: *edgeFmt}
+		if *streamOut != "" {
+			sf, err := os.Create(*streamOut)
+			if err != nil {
+				fatalf(exitInternal, "failed to create edge stream file %q: %v", *streamOut, err)
+			}
+			defer sf.Close()
+			s.w = sf
+		}
+		stream = func(e victor.Edge) {
+			if s == nil {
+				return
+			}
+			err := s.write(e)
+			if err != nil {
+				log.Printf("failed to stream edge: %v", err)
+				s = nil
+			}
+		}
+	default:
+		fatalf(exitUsage, "invalid edge stream format %q: must be json or tsv", *edgeFmt)
 	}
-	defer f.Close()
-	r := bufio.NewReader(f)
 
-	var families []family
-	for i := 0; ; i++ {
-		l, err := r.ReadBytes('\n')
+	var chromLen map[string]int
+	if *genome != "" {
+		var err error
+		chromLen, err = readGenome(*genome)
+		if os.IsNotExist(err) {
+			fatalf(exitNotFound, "failed reading genome %q: %v", *genome, err)
+		}
 		if err != nil {
-			break
+			fatalf(exitParse, "failed reading genome %q: %v", *genome, err)
+		}
+	}
+
+	useBits := *bitset
+	if chromLen != nil && !*weighted {
+		var total int
+		for _, n := range chromLen {
+			total += n
+		}
+		useBits = useBits || total <= victor.BitsetMax
+	}
+	if *pairsRaw {
+		// Bitsets do not record the number
+		// of members covering a position.
+		useBits = false
+	}
+
+	var (
+		families []victor.Family
+		empty    int
+
+		// source holds the input of each family
+		// when -input-attr is used.
+		source  map[int64]string
+		current string
+	)
+	if *inAttr {
+		source = make(map[int64]string)
+	}
+
+	// addFamily adds the family with index i, members v and the
+	// given name to families if it is not empty and has at least
+	// the minimum number of members.
+	addFamily := func(i int, v []victor.Feature, name string) {
+		if len(v) == 0 || (*minFam != 0 && len(v) < *minFam) {
+			return
+		}
+		// Family statistics and intersections are
+		// calculated from the binned coordinates.
+		var grid []victor.Feature
+		if *binSize > 1 {
+			grid = binned(v, *binSize)
+			if *snapOut {
+				v, grid = grid, nil
+			}
+		}
+		calc := v
+		if grid != nil {
+			calc = grid
+		}
+		raw := victor.RawLength(calc)
+		// Weighted and raw intersections depend on
+		// the individual members, so are not merged.
+		if !*weighted && !*pairsRaw {
+			var n int
+			grid, n = normalizeFamily(calc)
+			if n != 0 && *selfWarn {
+				log.Printf("family %d has %d self-overlapping members", i, n)
+			}
+			calc = grid
 		}
-		var v []feature
-		err = json.Unmarshal(l, &v)
+		ext := victor.Extents(calc)
+		fam := victor.Family{ID: int64(i), Members: v, Grid: grid, RawLength: raw, Span: victor.Span(ext), Extents: ext, Name: name}
+		var err error
+		fam.Length, err = victor.Length(calc)
 		if err != nil {
-			log.Fatalf("failed unmarshaling json for family %d: %v", i, err)
+			fatalf(exitParse, "failed calculating length of family %d: %v", i, err)
 		}
-		if *minFam != 0 && len(v) < *minFam {
-			continue
+		if *weighted {
+			fam.Weight, err = victor.WeightedLength(calc)
+			if err != nil {
+				fatalf(exitParse, "failed calculating weighted length of family %d: %v", i, err)
+			}
+			fam.Weighted = true
+		}
+		switch {
+		case useBits:
+			fam.Bits = victor.NewFamilyBits(calc, ext)
+		case !*weighted || *pairsRaw:
+			fam.Segments, err = victor.NewSegments(calc)
+			if err != nil {
+				fatalf(exitParse, "failed calculating segments of family %d: %v", i, err)
+			}
 		}
-		fam := family{id: int64(i), members: v, length: length(v)}
 
 		families = append(families, fam)
+		if source != nil {
+			source[fam.ID] = current
+		}
+	}
+
+	// add validates, clips and splits the family with index i
+	// before adding it so that input families need not be held.
+	var clipped, invalid int
+	add := func(i int, v []victor.Feature, name string) {
+		n := len(v)
+		kept := v[:0]
+		for j, f := range v {
+			err := checkFeature(f)
+			if err != nil {
+				if !*skipBad {
+					fatalf(exitParse, "invalid member %d of family %d at %q:%d-%d: %v", j, i, f.Chr, f.Start, f.End, err)
+				}
+				invalid++
+				continue
+			}
+			kept = append(kept, f)
+		}
+		v = kept
+		if chromLen != nil {
+			var n int
+			v, n = clip(v, chromLen)
+			clipped += n
+		}
+		if n != 0 && len(v) == 0 {
+			empty++
+		}
+		if !*splitStr {
+			addFamily(i, v, name)
+			return
+		}
+		plus, minus := splitStrands(v)
+		plusName, minusName := splitNames(name)
+		addFamily(2*i, plus, plusName)
+		addFamily(2*i+1, minus, minusName)
+	}
+
+	// Family indexes continue from the end of the
+	// previous input so that families from different
+	// inputs are never given the same ID.
+	var base int
+	for _, name := range strings.Split(*in, ",") {
+		current = name
+		f, err := openInput(name)
+		if err != nil {
+			fatalf(exitNotFound, "failed reading %q: %v", name, err)
+		}
+		r := bufio.NewReader(f)
+		var n int
+		switch *inFormat {
+		case "json":
+			sc := newFamilyScanner(r)
+			for sc.Scan() {
+				i, v := sc.Family()
+				add(base+i, v, "")
+				n = i + 1
+			}
+			err = sc.Err()
+			if err != nil {
+				fatalf(exitParse, "failed reading %q: %v", name, err)
+			}
+		case "bed":
+			members, names := readBED(r, *bedNameSep)
+			for i, v := range members {
+				add(base+i, v, names[i])
+			}
+			n = len(members)
+		}
+		f.Close()
+		base += n
+	}
+	if clipped != 0 {
+		fmt.Fprintf(diag, "clipped %d features to chromosome lengths\n", clipped)
+	}
+	if invalid != 0 {
+		log.Printf("skipped %d invalid features", invalid)
+	}
+	if empty != 0 {
+		log.Printf("skipped %d families without valid members", empty)
+	}
+	if len(families) == 0 {
+		fatalf(exitEmpty, "no families in %q", *in)
+	}
+	sort.Sort(victor.ByMembers(families))
+
+	if *covOut != "" {
+		writeCoverage(*covOut, families, chromLen)
+	}
+
+	if cmd == "convert" {
+		ann := annotations{source: source}
+		if *bedOut != "" {
+			writeBED(*bedOut, families, ann)
+		}
+		out, err := createOutput(*gffOut)
+		if err != nil {
+			fatalf(exitInternal, "failed to create %q GFF output file: %v", *gffOut, err)
+		}
+		err = writeFamilies(out, families, ann)
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			fatalf(exitInternal, "error: %v", err)
+		}
+		return
+	}
+
+	// Graph statistics are the output of the
+	// stats command and diagnostics otherwise.
+	report := diag
+	if cmd == "stats" {
+		report = os.Stdout
 	}
-	sort.Sort(byMembers(families))
 
-	c := connector{limit: make(chan struct{}, *threads)}
-	edges := c.edgesFor(families, *thresh)
+	c := victor.NewConnector(*threads)
+	c.Log = diag
+	c.Stream = stream
+	c.Orient = victor.Orientation{Penalty: *strandPen, UnknownAgrees: *unknown == "both"}
+	c.Combine = combine
+	c.Reciprocal = *reciprocal
+	if *threshLow != -1 {
+		c.LowerThresh = threshLow
+	}
+	c.Composite = comp
+	c.Weighted = *weighted
+	c.Raw = *pairsRaw
+	if *approx {
+		c.Similar = victor.ApproxSimilarity(families, *approxK, *approxBin, *thresh)
+	}
+	edgesFor := c.EdgesFor
+	if *lshBands != 0 {
+		cand := victor.LSHCandidates(families, *lshBands, *lshRows, *approxBin)
+		edgesFor = func(f []victor.Family, thresh float64) ([]victor.Edge, error) {
+			return c.EdgesAmong(f, cand, thresh)
+		}
+	}
+	if sweepRange != nil {
+		// Edges found at each sweep threshold
+		// are neither logged nor streamed.
+		c.Log = nil
+		c.Stream = nil
+		c.KeepPairs = true
+		_, err = edgesFor(families, math.Inf(1))
+		if err != nil {
+			fatalf(exitInternal, "failed comparing families: %v", err)
+		}
+		writeSweep(os.Stdout, c, families, c.Pairs, sweepRange, *subClique, *compKind)
+		return
+	}
+	c.KeepPairs = *pairsOut != "" || *edgesCSV != "" || *distOut != "" || *newickOut != "" || *histOut != "" || *pairStats || *threshPct != 0
+	var edges []victor.Edge
+	if *threshPct == 0 {
+		edges, err = edgesFor(families, *thresh)
+		if err != nil {
+			fatalf(exitInternal, "failed comparing families: %v", err)
+		}
+	} else {
+		// Collect all intersections before deciding
+		// on the threshold to use.
+		_, err = edgesFor(families, math.Inf(1))
+		if err != nil {
+			fatalf(exitInternal, "failed comparing families: %v", err)
+		}
+		*thresh = percentile(c, c.Pairs, *threshPct)
+		fmt.Fprintf(diag, "using threshold %v at the %vth percentile of intersections\n", *thresh, *threshPct)
+		edges = c.EdgesFrom(families, c.Pairs, *thresh)
+	}
+	n := len(families)
+	fmt.Fprintf(report, "evaluated %d of %d family pairs\n", c.Evaluated, n*(n-1)/2)
+	if *histOut != "" {
+		writeHistogram(*histOut, c.Pairs, *histBins, comp)
+	}
+	if *pairStats {
+		writePairStats(report, c.Pairs, *histBins, comp, *thresh)
+	}
+	if *pairsOut != "" {
+		writePairs(*pairsOut, c.Pairs, *pairsMin, *pairsRaw)
+	}
+	if *edgesCSV != "" {
+		writeEdgeTable(*edgesCSV, families, c.Pairs, *thresh)
+	}
+	if *distOut != "" {
+		writeDistances(*distOut, c, families, c.Pairs)
+	}
+	if *newickOut != "" {
+		writeNewick(*newickOut, agglomerate(c, families, c.Pairs, *linkage))
+	}
 
-	const minSubClique = 3
-	grps := groups(families, edges, *resolution, minSubClique, *cliques)
+	grps, err := victor.Groups(families, edges, victor.GroupConfig{
+		Method:          *clustMeth,
+		Seed:            *seed,
+		Resolution:      *resolution,
+		MinSubClique:    *subClique,
+		Cliques:         *cliques,
+		WeightedCliques: *wCliques,
+		Percolation:     *percolate,
+		MinMembers:      *minClust,
+		Damping:         *damping,
+		Tolerance:       *pageTol,
+	})
+	if err != nil {
+		fatalf(exitInternal, "failed grouping families: %v", err)
+	}
 
 	clusterIdentity := make(map[int64]int64)
 	cliqueIdentity := make(map[int64][]int64)
 	cliqueMemberships := make(map[int64]int64)
+	cliqueIDs := make(map[int64][]int64)
+	communityIdentity := make(map[int64][]int64)
 
 	for _, g := range grps {
 		// Collate counts for clique memberships. We cannot do
 		// this one group at a time; a member of a group can be
 		// a clique member of another group since they are in
 		// potentially in connection with other groups.
-		for _, clique := range g.cliques {
+		for _, clique := range g.Cliques {
 			for _, m := range clique {
 				cliqueMemberships[m]++
 			}
 		}
 	}
+	fmt.Fprintf(report, "graph density=%.3g\n", victor.Density(victor.PairsIn(edges), len(families)))
 	for _, g := range grps {
-		fmt.Fprintf(os.Stderr, "clique=%t", g.isClique)
-		for _, m := range g.members {
-			fmt.Fprintf(os.Stderr, " %d", m.id)
-			clusterIdentity[m.id] = g.pageRank[0].id
-			if g.isClique {
-				cliqueMemberships[m.id]++
-				cliqueIdentity[m.id] = []int64{g.pageRank[0].id}
+		fmt.Fprintf(diag, "clique=%t", g.IsClique)
+		if len(g.Members) > 1 {
+			fmt.Fprintf(diag, " density=%.3g", g.Density)
+		}
+		for _, m := range g.Members {
+			fmt.Fprintf(diag, " %d", m.ID)
+			clusterIdentity[m.ID] = g.PageRank[0].ID
+			if g.IsClique {
+				cliqueMemberships[m.ID]++
+				cliqueIdentity[m.ID] = []int64{g.PageRank[0].ID}
+				cliqueIDs[m.ID] = append(cliqueIDs[m.ID], g.PageRank[0].ID)
 			}
 		}
-		if len(g.cliques) != 0 {
-			fmt.Fprintf(os.Stderr, " (%d+)-cliquesIn=%v", minSubClique, g.cliques)
+		if len(g.Cliques) != 0 {
+			fmt.Fprintf(diag, " (%d+)-cliquesIn=%v", *subClique, g.Cliques)
+		}
+		if len(g.Communities) != 0 {
+			fmt.Fprintf(diag, " %d-cliqueCommunities=%v", *percolate, g.Communities)
+		}
+		for _, c := range g.Communities {
+			for _, m := range c {
+				communityIdentity[m] = append(communityIdentity[m], c[0])
+			}
 		}
-		for _, clique := range g.cliques {
+		for _, clique := range g.Cliques {
 			// Make PageRanked version of clique.
 			cliqueHas := make(map[int64]bool)
 			for _, m := range clique {
 				cliqueHas[m] = true
 			}
 			clique = make([]int64, 0, len(clique))
-			for _, m := range g.pageRank {
-				if cliqueHas[m.id] {
-					clique = append(clique, m.id)
+			for _, m := range g.PageRank {
+				if cliqueHas[m.ID] {
+					clique = append(clique, m.ID)
 				}
 			}
 
 			// Annotate families as meaningfully but concisely as possible.
 			unique := cliqueMemberships[clique[0]] == 1
 			for i, m := range clique {
+				cliqueIDs[m] = append(cliqueIDs[m], clique[0])
 				if cliqueMemberships[m] == 1 {
 					if unique {
 						cliqueIdentity[m] = clique[:1]
@@ -140,315 +976,553 @@ func main() {
 				}
 			}
 		}
-		fmt.Fprintf(os.Stderr, " PageRank=%+v\n", g.pageRank)
+		fmt.Fprintf(diag, " PageRank=%+v\n", g.PageRank)
+	}
+	sum := summarize(families, edges, grps, cliqueMemberships, *compKind)
+	writeSummary(report, sum)
+	if cmd == "stats" {
+		return
 	}
 	for i, e := range edges {
-		if clustID, isClustered := clusterIdentity[e.from.id]; isClustered {
-			edges[i].from.cluster = clustID
+		if clustID, isClustered := clusterIdentity[e.F.ID()]; isClustered {
+			edges[i].F.Cluster = clustID
+		}
+		if clustID, isClustered := clusterIdentity[e.T.ID()]; isClustered {
+			edges[i].T.Cluster = clustID
+		}
+	}
+	if *laplacian != "" {
+		writeLaplacian(*laplacian, families, edges)
+	}
+	if *adjOut != "" {
+		writeAdjacency(*adjOut, families, edges)
+	}
+	style := dotStyle{colour: clusterColours(clusterIdentity), cliques: cliqueMemberships}
+	if *dotOut != "" || *graphML != "" {
+		var isolated []victor.Node
+		if *dotAll {
+			isolated = isolatedNodes(families, edges, clusterIdentity)
+		}
+		if *dotOut != "" {
+			writeDOT(*dotOut, edges, isolated, *dotUndir, *dotEngine, style)
 		}
-		if clustID, isClustered := clusterIdentity[e.to.id]; isClustered {
-			edges[i].to.cluster = clustID
+		if *graphML != "" {
+			writeGraphML(*graphML, edges, isolated, *dotUndir)
 		}
 	}
-	if *dotOut != "" {
-		writeDOT(*dotOut, edges)
+	if *sccOut != "" {
+		writeCondensation(*sccOut, edges, *dotEngine)
+	}
+	if *dotDir != "" {
+		writeComponentDOTs(*dotDir, grps, edges, *dotUndir, *dotEngine, style)
+	}
+	if *bedpeOut != "" {
+		writeBEDPE(*bedpeOut, families, edges)
 	}
 
-	b := bufio.NewWriter(os.Stdout)
-	defer b.Flush()
-	w := gff.NewWriter(b, 60, false)
-	ft := &gff.Feature{
-		Source:  "igor/victor",
-		Feature: "repeat",
-		FeatAttributes: gff.Attributes{
-			{Tag: "Family"},
-			{Tag: "Cluster"},
-			{Tag: "Clique"},
-		},
+	var score map[int64]int
+	switch {
+	case *scoreBy == "pagerank":
+		score = scaledRanks(grps, *scoreScale)
+	case *scoreBy == "maxedge":
+		score = maxEdges(edges)
 	}
-	for _, fam := range families {
-		clustID, isClustered := clusterIdentity[fam.id]
-		for _, m := range fam.members {
-			ft.SeqName = m.Chr
-			ft.FeatStart = m.Start
-			ft.FeatEnd = m.End
-			ft.FeatStrand = m.Orient
-			ft.FeatFrame = gff.NoFrame
-			ft.FeatAttributes[0].Value = fmt.Sprint(fam.id)
-			if isClustered {
-				ft.FeatAttributes = ft.FeatAttributes[:3]
-				ft.FeatAttributes[1].Value = fmt.Sprint(clustID)
-				switch id := cliqueIdentity[fam.id]; {
-				case id == nil:
-					ft.FeatAttributes = ft.FeatAttributes[:2]
-				case cliqueMemberships[fam.id] == 1:
-					ft.FeatAttributes[2].Value = dotted(id)
-				default:
-					ft.FeatAttributes[2].Value = fmt.Sprintf("%d*", id[0])
-				}
-			} else {
-				ft.FeatAttributes = ft.FeatAttributes[:1]
-			}
-			_, err := w.Write(ft)
-			if err != nil {
-				log.Fatalf("error: %v", err)
+	rank := make(map[int64]float64)
+	for _, g := range grps {
+		for _, r := range g.PageRank {
+			rank[r.ID] = r.Rank
+		}
+	}
+	ann := annotations{
+		cluster:           clusterIdentity,
+		clique:            cliqueIdentity,
+		cliqueMemberships: cliqueMemberships,
+		cliqueIDs:         cliqueIDs,
+		community:         communityIdentity,
+		rank:              rank,
+		score:             score,
+		source:            source,
+	}
+	if *confAttr {
+		ann.confidence = confidences(grps, edges)
+	}
+	if *coreAttr {
+		ann.core = make(map[int64]int)
+		for _, g := range grps {
+			for id, k := range victor.CoresIn(g, edges) {
+				ann.core[id] = k
 			}
 		}
 	}
-}
-
-type feature struct {
-	Chr    string     `json:"C"`
-	Start  int        `json:"S"`
-	End    int        `json:"E"`
-	Orient seq.Strand `json:"O"`
-}
-
-type family struct {
-	id      int64
-	members []feature
-	length  int
-}
-
-type byMembers []family
+	if *jsonlOut != "" {
+		writeJSONL(*jsonlOut, families, ann)
+	}
+	if *cliqueCnt != "" {
+		writeCliqueCounts(*cliqueCnt, families, cliqueMemberships)
+	}
+	if *repsOut != "" {
+		writeRepresentatives(*repsOut, grps)
+	}
+	if *clustOut != "" {
+		writeClusters(*clustOut, grps)
+	}
+	if *summOut != "" {
+		writeGroups(*summOut, grps)
+	}
+	if *bedOut != "" {
+		writeBED(*bedOut, families, ann)
+	}
+	if *clusterGFF != "" {
+		writeClusterGFFs(*clusterGFF, families, ann)
+	}
+	if *splitChrom != "" {
+		writeChromGFFs(*splitChrom, families, ann)
+	}
 
-func (f byMembers) Len() int           { return len(f) }
-func (f byMembers) Less(i, j int) bool { return len(f[i].members) > len(f[j].members) }
-func (f byMembers) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+	out, err := createOutput(*gffOut)
+	if err != nil {
+		fatalf(exitInternal, "failed to create %q GFF output file: %v", *gffOut, err)
+	}
+	gw := gff.NewWriter(out, 60, false)
+	for _, p := range provenance() {
+		_, err = gw.WriteMetaData(p)
+		if err != nil {
+			fatalf(exitInternal, "error: %v", err)
+		}
+	}
+	err = writeFamilies(out, families, ann)
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		fatalf(exitInternal, "error: %v", err)
+	}
 
-type node struct {
-	id      int64
-	cluster int64
-	members int
+	if *metaOut != "" {
+		writeMeta(*metaOut, fs, sum, time.Since(start))
+	}
 }
 
-var _ encoding.Attributer = node{}
-
-func (n node) ID() int64 { return n.id }
-func (n node) Attributes() []encoding.Attribute {
-	if n.cluster == -1 {
-		return []encoding.Attribute{{"members", fmt.Sprint(n.members)}}
+// provenance returns GFF directive lines recording the parameters used
+// for a clustering run.
+func provenance() []string {
+	upper, lower := "upper", "lower"
+	if *weighted {
+		upper, lower = "weighted-upper", "weighted-lower"
 	}
-	return []encoding.Attribute{
-		{"cluster", fmt.Sprint(n.cluster)},
-		{"members", fmt.Sprint(n.members)},
+	metric := upper
+	switch {
+	case *approx:
+		metric = fmt.Sprintf("minhash-jaccard hashes=%d bin=%d", *approxK, *approxBin)
+	case *metricWts != "":
+		metric = *metricWts
+	case *reciprocal:
+		metric = lower
+	case *collapse != "":
+		metric = fmt.Sprintf("%s(%s,%s)", *collapse, upper, lower)
+	}
+	lowerThresh := *thresh
+	if *threshLow != -1 {
+		lowerThresh = *threshLow
+	}
+	gate := fmt.Sprintf("victor-thresh %v lower=%v", *thresh, lowerThresh)
+	if *threshPct != 0 {
+		gate += fmt.Sprintf(" percentile=%v", *threshPct)
+	}
+	if *lshBands != 0 {
+		gate += fmt.Sprintf(" lsh-bands=%d lsh-rows=%d", *lshBands, *lshRows)
+	}
+	return []string{
+		fmt.Sprintf("victor-version %s", buildVersion()),
+		fmt.Sprintf("victor-input %s", *in),
+		gate,
+		fmt.Sprintf("victor-metric %s", metric),
+		fmt.Sprintf("victor-cluster-method %s resolution=%v seed=%d", *clustMeth, *resolution, *seed),
+		fmt.Sprintf("victor-min-subclique %d", *subClique),
+		fmt.Sprintf("victor-centrality pagerank damping=%v tol=%v", *damping, *pageTol),
 	}
 }
 
-type edge struct {
-	from, to node
-	weight   float64
+// createOutput creates the named output file, or returns standard
+// output if name is empty. Closing standard output is a no-op.
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(name)
 }
 
-var _ encoding.Attributer = edge{}
-
-func (e edge) From() graph.Node { return e.from }
-func (e edge) To() graph.Node   { return e.to }
-func (e edge) Weight() float64  { return e.weight }
-func (e edge) Attributes() []encoding.Attribute {
-	return []encoding.Attribute{{"weight", fmt.Sprint(e.weight)}}
+// nopCloser is an io.WriteCloser with a no-op Close method.
+type nopCloser struct {
+	io.Writer
 }
 
-// stepBool is a bool type satisfying the step.Equaler interface.
-type stepBool bool
+func (nopCloser) Close() error { return nil }
+
+// writeFamilies writes the members of fams to w as GFF features annotated
+// with ann in the order specified by -sort.
+func writeFamilies(w io.Writer, fams []victor.Family, ann annotations) error {
+	b := bufio.NewWriter(w)
+	var err error
+	if *sortBy == "" {
+		err = writeGFF(b, fams, ann)
+	} else {
+		// Sorted output requires that all the
+		// features are held before writing.
+		members := sortedMembers(fams, ann, *sortBy)
+		err = writeMembers(b, members, ann)
+	}
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
 
-// Equal returns whether b equals e. Equal assumes the underlying type of e is a stepBool.
-func (b stepBool) Equal(e step.Equaler) bool {
-	return b == e.(stepBool)
+// annotations holds the cluster, clique and community labels and the
+// scores assigned to families.
+type annotations struct {
+	cluster           map[int64]int64
+	clique            map[int64][]int64
+	cliqueMemberships map[int64]int64
+	cliqueIDs         map[int64][]int64
+	community         map[int64][]int64
+	rank              map[int64]float64
+	score             map[int64]int
+	confidence        map[int64]float64
+	core              map[int64]int
+	source            map[int64]string
 }
 
-// length returns the number of covered bases in v.
-func length(v []feature) int {
-	vecs := make(map[string]*step.Vector)
-	for _, f := range v {
-		vec, ok := vecs[f.Chr]
-		if !ok {
-			var err error
-			vec, err = step.New(f.Start, f.End, stepBool(false))
+// writeGFF writes the members of fams to w as GFF features annotated
+// with ann.
+func writeGFF(w io.Writer, fams []victor.Family, ann annotations) error {
+	gw := gff.NewWriter(w, 60, false)
+	ft := newFeature()
+	for i := range fams {
+		for _, m := range fams[i].Members {
+			setFeature(ft, &fams[i], m, ann)
+			_, err := gw.Write(ft)
 			if err != nil {
-				panic(err)
+				return err
 			}
-			vec.Relaxed = true
-			vecs[f.Chr] = vec
 		}
-		vec.SetRange(f.Start, f.End, stepBool(true))
-	}
-	var len int
-	for _, vec := range vecs {
-		vec.Do(func(start, end int, e step.Equaler) {
-			if e.(stepBool) {
-				len += end - start
-			}
-		})
 	}
-	return len
-}
-
-// connector handles parallel analysis of family intersections.
-type connector struct {
-	wg sync.WaitGroup
-
-	mu    sync.Mutex
-	edges []edge
-
-	// limit specifies the maximum number
-	// of concurrent intersection calls.
-	limit chan struct{}
+	return nil
 }
 
-// acquire gets an available worker thread.
-func (c *connector) acquire() {
-	c.wg.Add(1)
-	c.limit <- struct{}{}
+// member is a family member feature.
+type member struct {
+	fam *victor.Family
+	victor.Feature
 }
 
-// release puts pack a worker thread.
-func (c *connector) release() {
-	<-c.limit
-	c.wg.Done()
+// writeMembers writes members to w as GFF features annotated with ann.
+func writeMembers(w io.Writer, members []member, ann annotations) error {
+	gw := gff.NewWriter(w, 60, false)
+	ft := newFeature()
+	for _, m := range members {
+		setFeature(ft, m.fam, m.Feature, ann)
+		_, err := gw.Write(ft)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// connect adds e to the store of edges.
-func (c *connector) connect(e edge) {
-	c.mu.Lock()
-	fmt.Fprintln(os.Stderr, e.from.id, e.to.id, e.weight)
-	c.edges = append(c.edges, e)
-	c.mu.Unlock()
+// newFeature returns a GFF feature for writing victor output.
+func newFeature() *gff.Feature {
+	return &gff.Feature{
+		Source:  *gffSource,
+		Feature: *gffType,
+	}
 }
 
-// edgesFor returns the edges that exist between families in f where
-// the intersection is greater than or equal to thresh.
-func (c *connector) edgesFor(f []family, thresh float64) []edge {
-	for i, a := range f[:len(f)-1] {
-		for _, b := range f[i+1:] {
-			a := a
-			b := b
-			c.acquire()
-			go func() {
-				defer c.release()
-				upper, lower := intersection(a, b)
-				if upper < thresh {
-					return
-				}
-
-				// Edges indicate connection from the shorter
-				// family to the longer family, so ensure this
-				// is the state now.
-				if a.length > b.length {
-					a, b = b, a
-				}
-
-				c.connect(edge{
-					from:   node{id: a.id, cluster: -1, members: len(a.members)},
-					to:     node{id: b.id, cluster: -1, members: len(b.members)},
-					weight: upper,
-				})
-
-				if lower < thresh {
-					return
-				}
+// setFeature sets the fields of ft to describe the member m of fam
+// annotated with ann.
+func setFeature(ft *gff.Feature, fam *victor.Family, m victor.Feature, ann annotations) {
+	ft.SeqName = m.Chr
+	ft.FeatStart = m.Start
+	ft.FeatEnd = m.End
+	ft.FeatStrand = m.Orient
+	ft.FeatFrame = gff.NoFrame
+	ft.FeatScore = nil
+	if sc, ok := ann.score[fam.ID]; ok {
+		v := float64(sc)
+		ft.FeatScore = &v
+	}
+	ft.FeatAttributes = ft.FeatAttributes[:0]
+	if m.ID != "" {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "ID", Value: m.ID})
+	}
+	ft.FeatAttributes = append(ft.FeatAttributes,
+		gff.Attribute{Tag: "Family", Value: fmt.Sprint(fam.ID)},
+		gff.Attribute{Tag: "Members", Value: fmt.Sprint(len(fam.Members))},
+		gff.Attribute{Tag: "Length", Value: fmt.Sprint(fam.Length)},
+	)
+	if *rawLength {
+		ft.FeatAttributes = append(ft.FeatAttributes,
+			gff.Attribute{Tag: "RawLength", Value: fmt.Sprint(fam.RawLength)},
+			gff.Attribute{Tag: "SelfOverlap", Value: fmt.Sprint(float64(fam.RawLength) / float64(fam.Length))},
+		)
+	}
+	if *covAttr && fam.Span != 0 {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Coverage", Value: fmt.Sprint(float64(fam.Length) / float64(fam.Span))})
+	}
+	if src, ok := ann.source[fam.ID]; ok {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Input", Value: strconv.Quote(src)})
+	}
+	clustID, isClustered := ann.cluster[fam.ID]
+	if !isClustered {
+		return
+	}
+	ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Cluster", Value: fmt.Sprint(clustID)})
+	if conf, ok := ann.confidence[fam.ID]; ok {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Confidence", Value: fmt.Sprint(conf)})
+	}
+	if clique := cliqueLabel(ann.clique[fam.ID], ann.cliqueMemberships[fam.ID]); clique != "" {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Clique", Value: clique})
+	}
+	if *allCliques && ann.cliqueMemberships[fam.ID] > 1 {
+		ft.FeatAttributes = append(ft.FeatAttributes,
+			gff.Attribute{Tag: "Cliques", Value: joined(ann.cliqueIDs[fam.ID], ",")},
+			gff.Attribute{Tag: "Ambiguous", Value: "true"},
+		)
+	}
+	if c := ann.community[fam.ID]; c != nil {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Community", Value: joined(c, ",")})
+	}
+	if k, ok := ann.core[fam.ID]; ok {
+		ft.FeatAttributes = append(ft.FeatAttributes, gff.Attribute{Tag: "Core", Value: fmt.Sprint(k)})
+	}
+}
 
-				c.connect(edge{
-					from:   node{id: b.id, cluster: -1, members: len(b.members)},
-					to:     node{id: a.id, cluster: -1, members: len(a.members)},
-					weight: lower,
-				})
-			}()
+// sortedMembers returns the members of fams sorted by position or,
+// if by is "cluster", by cluster and then by position. Unclustered
+// families are placed after all clusters.
+func sortedMembers(fams []victor.Family, ann annotations, by string) []member {
+	var members []member
+	for i := range fams {
+		for _, m := range fams[i].Members {
+			members = append(members, member{fam: &fams[i], Feature: m})
 		}
 	}
-	c.wg.Wait()
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	byPos := membersByPosition(members)
+	if by != "cluster" {
+		sort.Sort(byPos)
+		return members
+	}
+	sort.Slice(members, func(i, j int) bool {
+		ci, iok := ann.cluster[members[i].fam.ID]
+		cj, jok := ann.cluster[members[j].fam.ID]
+		if iok != jok {
+			return iok
+		}
+		if ci != cj {
+			return ci < cj
+		}
+		return byPos.Less(i, j)
+	})
+	return members
+}
 
-	return c.edges
+// writeChromGFFs writes the members of fams to a GFF file for each
+// chromosome, <chrom>.gff, in the named directory. Features within
+// each file are sorted by position.
+func writeChromGFFs(dir string, fams []victor.Family, ann annotations) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		log.Printf("failed to create %q chromosome GFF directory: %v", dir, err)
+		return
+	}
+	var (
+		chrs    []string
+		members = make(map[string][]member)
+	)
+	for i := range fams {
+		for _, m := range fams[i].Members {
+			if _, ok := members[m.Chr]; !ok {
+				chrs = append(chrs, m.Chr)
+			}
+			members[m.Chr] = append(members[m.Chr], member{fam: &fams[i], Feature: m})
+		}
+	}
+	for _, chr := range chrs {
+		sort.Sort(membersByPosition(members[chr]))
+		name := chr + ".gff"
+		err = writeFile(filepath.Join(dir, name), func(w io.Writer) error {
+			return writeMembers(w, members[chr], ann)
+		})
+		if err != nil {
+			log.Printf("failed to write %q chromosome GFF: %v", name, err)
+			return
+		}
+	}
 }
 
-// pair is a [2]bool type satisfying the step.Equaler interface.
-type pair [2]bool
+// membersByPosition sorts members by chromosome and then position.
+type membersByPosition []member
 
-// Equal returns whether p equals e. Equal assumes the underlying type of e is pair.
-func (p pair) Equal(e step.Equaler) bool {
-	return p == e.(pair)
+func (m membersByPosition) Len() int { return len(m) }
+func (m membersByPosition) Less(i, j int) bool {
+	if m[i].Chr != m[j].Chr {
+		return m[i].Chr < m[j].Chr
+	}
+	if m[i].Start != m[j].Start {
+		return m[i].Start < m[j].Start
+	}
+	return m[i].End < m[j].End
 }
+func (m membersByPosition) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
 
-func intersection(a, b family) (upper, lower float64) {
-	// TODO(kortschak): Consider orientation agreement.
-	vecs := make(map[string]*step.Vector)
-	for i, v := range []family{a, b} {
-		for _, f := range v.members {
-			vec, ok := vecs[f.Chr]
-			if !ok {
-				var err error
-				vec, err = step.New(f.Start, f.End, pair{})
-				if err != nil {
-					panic(err)
-				}
-				vec.Relaxed = true
-				vecs[f.Chr] = vec
-			}
-			err := vec.ApplyRange(f.Start, f.End, func(e step.Equaler) step.Equaler {
-				p := e.(pair)
-				p[i] = true
-				return p
-			})
-			if err != nil {
-				panic(err)
-			}
-		}
+// writeClusterGFFs writes the members of each cluster of fams to its own
+// GFF file, cluster-<id>.gff, in the named directory. Unclustered families
+// are written to singletons.gff.
+func writeClusterGFFs(dir string, fams []victor.Family, ann annotations) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		log.Printf("failed to create %q cluster GFF directory: %v", dir, err)
+		return
 	}
 	var (
-		aLen, bLen int
-		intersect  int
+		clusters  []int64
+		clustered = make(map[int64][]victor.Family)
 	)
-	for _, vec := range vecs {
-		vec.Do(func(start, end int, e step.Equaler) {
-			p := e.(pair)
-			if p[0] {
-				aLen += end - start
-			}
-			if p[1] {
-				bLen += end - start
-			}
-			if p[0] && p[1] {
-				intersect += end - start
-			}
+	for _, fam := range fams {
+		clustID, isClustered := ann.cluster[fam.ID]
+		if !isClustered {
+			clustID = -1
+		}
+		if _, ok := clustered[clustID]; !ok {
+			clusters = append(clusters, clustID)
+		}
+		clustered[clustID] = append(clustered[clustID], fam)
+	}
+	for _, c := range clusters {
+		name := fmt.Sprintf("cluster-%d.gff", c)
+		if c == -1 {
+			name = "singletons.gff"
+		}
+		err = writeFile(filepath.Join(dir, name), func(w io.Writer) error {
+			return writeGFF(w, clustered[c], ann)
 		})
+		if err != nil {
+			log.Printf("failed to write %q cluster GFF: %v", name, err)
+			return
+		}
 	}
-	if aLen != a.length || bLen != b.length {
-		panic("length mismatch")
+}
+
+// writeFile calls fn to write to the named file through a buffer.
+func writeFile(file string, fn func(io.Writer) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
 	}
+	b := bufio.NewWriter(f)
+	err = fn(b)
+	if err == nil {
+		err = b.Flush()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-	upper = float64(intersect) / math.Min(float64(a.length), float64(b.length))
-	lower = float64(intersect) / math.Max(float64(a.length), float64(b.length))
-	return upper, lower
+// percentile returns the threshold weight found by c at the p-th
+// percentile of pairs using the nearest-rank method. Only intersecting
+// pairs are recorded, so pairs that do not intersect are not included.
+func percentile(c *victor.Connector, pairs []victor.Similarity, p float64) float64 {
+	if len(pairs) == 0 {
+		return math.Inf(1)
+	}
+	w := make([]float64, len(pairs))
+	for i, s := range pairs {
+		w[i] = c.Weight(s)
+	}
+	sort.Float64s(w)
+	i := int(math.Ceil(p/100*float64(len(w)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return w[i]
 }
 
 func dotted(id []int64) string {
+	return joined(id, ".")
+}
+
+// joined returns the elements of id separated by sep.
+func joined(id []int64, sep string) string {
 	var buf bytes.Buffer
 	for i, e := range id {
 		if i != 0 {
-			fmt.Fprint(&buf, ".")
+			fmt.Fprint(&buf, sep)
 		}
 		fmt.Fprint(&buf, e)
 	}
 	return buf.String()
 }
 
-func writeDOT(file string, edges []edge) {
-	g := simple.NewWeightedDirectedGraph(0, math.Inf(1))
+// cliqueLabel returns the Clique annotation for a family with the given
+// clique identity and number of clique memberships. An empty string is
+// returned if the family is not a clique member.
+func cliqueLabel(id []int64, memberships int64) string {
+	switch {
+	case id == nil:
+		return ""
+	case memberships == 1:
+		return dotted(id)
+	default:
+		return fmt.Sprintf("%d*", id[0])
+	}
+}
+
+// isolatedNodes returns nodes for the families in fams that are not
+// joined to any other family by edges.
+func isolatedNodes(fams []victor.Family, edges []victor.Edge, cluster map[int64]int64) []victor.Node {
+	connected := make(victor.IntSet)
 	for _, e := range edges {
-		for _, n := range []graph.Node{e.From(), e.To()} {
-			if !g.Has(n) {
-				g.AddNode(n)
-			}
+		connected.Add(e.F.ID())
+		connected.Add(e.T.ID())
+	}
+	var nodes []victor.Node
+	for _, fam := range fams {
+		if connected.Has(fam.ID) {
+			continue
 		}
-		g.SetWeightedEdge(e)
+		n := victor.NodeOf(fam)
+		if clustID, isClustered := cluster[fam.ID]; isClustered {
+			n.Cluster = clustID
+		}
+		nodes = append(nodes, n)
 	}
+	return nodes
+}
 
-	f, err := os.Create(*dotOut)
+// writeDOT writes the graph of edges and the additional nodes in
+// isolated to the named file in DOT format. If symmetric is true the
+// graph is written as an undirected graph with a single edge between
+// each connected pair of families. Clustered nodes are filled with the
+// colour given by style and clique members are drawn as boxes.
+func writeDOT(file string, edges []victor.Edge, isolated []victor.Node, symmetric bool, layout string, style dotStyle) {
+	hint := dotLayout{style: style}
+	if layout != "" {
+		hint.graph = dotAttrs{{"layout", layout}, {"overlap", "false"}}
+	}
+	var g graph.Graph
+	switch eg := exportGraph(edges, isolated, symmetric).(type) {
+	case *simple.UndirectedGraph:
+		g = undirectedDOT{eg, hint}
+	case *simple.WeightedDirectedGraph:
+		g = directedDOT{eg, hint}
+	}
+
+	f, err := os.Create(file)
 	if err != nil {
-		log.Printf("failed to create %q DOT output file: %v", *dotOut, err)
+		log.Printf("failed to create %q DOT output file: %v", file, err)
 		return
 	}
 	defer f.Close()
@@ -463,177 +1537,1083 @@ func writeDOT(file string, edges []edge) {
 	}
 }
 
-type group struct {
-	members  []family
-	isClique bool
-	cliques  [][]int64
-	pageRank ranks
+// exportGraph returns the graph of edges and the additional nodes in
+// isolated written by the DOT and GraphML outputs. Only the first of
+// any repeated edge is retained. If symmetric is true the graph is a
+// *simple.UndirectedGraph, otherwise it is a *simple.WeightedDirectedGraph.
+func exportGraph(edges []victor.Edge, isolated []victor.Node, symmetric bool) graph.Graph {
+	var g interface {
+		graph.Graph
+		AddNode(graph.Node)
+	}
+	if symmetric {
+		u := victor.Undirected(edges, nil)
+		seen := make(victor.PairSet)
+		for _, e := range edges {
+			if !seen.Has(e.F.ID(), e.T.ID()) {
+				seen.Add(e.F.ID(), e.T.ID())
+				u.SetEdge(dotEdge{e, *dotPrec})
+			}
+		}
+		g = u
+	} else {
+		d := victor.Directed(edges, nil, 0, math.Inf(1))
+		seen := make(map[[2]int64]struct{})
+		for _, e := range edges {
+			uv := [2]int64{e.F.ID(), e.T.ID()}
+			if _, ok := seen[uv]; !ok {
+				seen[uv] = struct{}{}
+				d.SetWeightedEdge(dotEdge{e, *dotPrec})
+			}
+		}
+		g = d
+	}
+	for _, n := range isolated {
+		if !g.Has(n) {
+			g.AddNode(n)
+		}
+	}
+	return g
+}
+
+// writeGraphML writes the graph of edges and the additional nodes in
+// isolated to the named file in GraphML format. Nodes are identified
+// by family ID and edges carry a weight data element.
+func writeGraphML(file string, edges []victor.Edge, isolated []victor.Node, symmetric bool) {
+	g := exportGraph(edges, isolated, symmetric)
+	doc := graphMLDoc{
+		Keys: []graphMLKey{{ID: "weight", For: "edge", Name: "weight", Type: "double"}},
+		Graph: graphMLGraph{
+			ID:          "G",
+			EdgeDefault: "directed",
+		},
+	}
+	if symmetric {
+		doc.Graph.EdgeDefault = "undirected"
+	}
+
+	nodes := g.Nodes()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	for _, n := range nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: strconv.FormatInt(n.ID(), 10)})
+	}
+	var ges []graph.Edge
+	switch eg := g.(type) {
+	case *simple.UndirectedGraph:
+		ges = eg.Edges()
+	case *simple.WeightedDirectedGraph:
+		ges = eg.Edges()
+	}
+	sort.Slice(ges, func(i, j int) bool {
+		fi, fj := ges[i].From().ID(), ges[j].From().ID()
+		if fi != fj {
+			return fi < fj
+		}
+		return ges[i].To().ID() < ges[j].To().ID()
+	})
+	for _, e := range ges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: strconv.FormatInt(e.From().ID(), 10),
+			Target: strconv.FormatInt(e.To().ID(), 10),
+			Data: []graphMLData{{
+				Key:   "weight",
+				Value: strconv.FormatFloat(e.(graph.WeightedEdge).Weight(), 'g', *dotPrec, 64),
+			}},
+		})
+	}
+
+	b, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		log.Printf("failed to create GraphML bytes: %v", err)
+		return
+	}
+	err = os.WriteFile(file, append([]byte(xml.Header), append(b, '\n')...), 0644)
+	if err != nil {
+		log.Printf("failed to write %q GraphML: %v", file, err)
+	}
+}
+
+// graphMLDoc and its element types are the GraphML serialization of a
+// family graph.
+type (
+	graphMLDoc struct {
+		XMLName xml.Name     `xml:"http://graphml.graphdrawing.org/xmlns graphml"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   graphMLGraph `xml:"graph"`
+	}
+	graphMLKey struct {
+		ID   string `xml:"id,attr"`
+		For  string `xml:"for,attr"`
+		Name string `xml:"attr.name,attr"`
+		Type string `xml:"attr.type,attr"`
+	}
+	graphMLGraph struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	}
+	graphMLNode struct {
+		ID string `xml:"id,attr"`
+	}
+	graphMLEdge struct {
+		Source string        `xml:"source,attr"`
+		Target string        `xml:"target,attr"`
+		Data   []graphMLData `xml:"data"`
+	}
+	graphMLData struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+// dotEdge is an edge with its weight written to DOT with the
+// given number of significant figures.
+type dotEdge struct {
+	victor.Edge
+	prec int
+}
+
+func (e dotEdge) Attributes() []encoding.Attribute {
+	return []encoding.Attribute{{"weight", strconv.FormatFloat(e.W, 'g', e.prec, 64)}}
 }
 
-func groups(fams []family, edges []edge, resolution float64, minSubClique int, cliques bool) []group {
-	g := simple.NewWeightedDirectedGraph(0, 0)
+// dotAttrs is a set of DOT attributes.
+type dotAttrs []encoding.Attribute
+
+func (a dotAttrs) Attributes() []encoding.Attribute { return a }
+
+// dotLayout holds the graph-level attributes of a DOT graph
+// and the style of its nodes.
+type dotLayout struct {
+	graph dotAttrs
+	style dotStyle
+}
+
+func (l dotLayout) DOTAttributers() (graph, node, edge encoding.Attributer) {
+	return l.graph, dotAttrs(nil), dotAttrs(nil)
+}
+
+// dotStyle holds the fill colour of each cluster, keyed by cluster
+// ID, and the number of cliques each family is a member of.
+type dotStyle struct {
+	colour  map[int64]string
+	cliques map[int64]int64
+}
+
+// styled returns nodes with the victor.Node elements wrapped
+// as dotNodes.
+func (s dotStyle) styled(nodes []graph.Node) []graph.Node {
+	for i, n := range nodes {
+		vn, ok := n.(victor.Node)
+		if !ok {
+			continue
+		}
+		nodes[i] = dotNode{Node: vn, fill: dotColour(s.colour[vn.Cluster]), clique: s.cliques[vn.ID()] != 0}
+	}
+	return nodes
+}
+
+// dotColour returns the DOT form of an itemRgb colour,
+// or the empty string if rgb is empty.
+func dotColour(rgb string) string {
+	if rgb == "" {
+		return ""
+	}
+	var r, g, b uint8
+	fmt.Sscanf(rgb, "%d,%d,%d", &r, &g, &b)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// dotNode is a family node with its fill colour and shape.
+type dotNode struct {
+	victor.Node
+	fill   string
+	clique bool
+}
+
+func (n dotNode) Attributes() []encoding.Attribute {
+	attrs := n.Node.Attributes()
+	if n.fill != "" {
+		attrs = append(attrs,
+			encoding.Attribute{"style", "filled"},
+			encoding.Attribute{"fillcolor", strconv.Quote(n.fill)},
+		)
+	}
+	if n.clique {
+		attrs = append(attrs, encoding.Attribute{"shape", "box"})
+	}
+	return attrs
+}
+
+// directedDOT and undirectedDOT are graphs with graph-level DOT attributes.
+type (
+	directedDOT struct {
+		*simple.WeightedDirectedGraph
+		dotLayout
+	}
+	undirectedDOT struct {
+		*simple.UndirectedGraph
+		dotLayout
+	}
+)
+
+func (g directedDOT) Nodes() []graph.Node {
+	return g.style.styled(g.WeightedDirectedGraph.Nodes())
+}
+func (g undirectedDOT) Nodes() []graph.Node {
+	return g.style.styled(g.UndirectedGraph.Nodes())
+}
+
+// sccNode is a strongly connected component of the family graph.
+type sccNode struct {
+	id      int64
+	members []int64
+}
+
+func (n sccNode) ID() int64 { return n.id }
+func (n sccNode) Attributes() []encoding.Attribute {
+	return []encoding.Attribute{
+		{"label", strconv.Quote(joined(n.members, ","))},
+		{"size", fmt.Sprint(len(n.members))},
+	}
+}
+
+// sccEdge is an edge between strongly connected components holding the
+// greatest weight of the family edges between them.
+type sccEdge struct {
+	from, to sccNode
+	weight   float64
+}
+
+func (e sccEdge) From() graph.Node { return e.from }
+func (e sccEdge) To() graph.Node   { return e.to }
+func (e sccEdge) Weight() float64  { return e.weight }
+func (e sccEdge) Attributes() []encoding.Attribute {
+	return []encoding.Attribute{{"weight", strconv.FormatFloat(e.weight, 'g', *dotPrec, 64)}}
+}
+
+// writeCondensation writes the condensation of the graph of edges to the
+// named file in DOT format. Each strongly connected component of families
+// is collapsed to a single node identified by its lowest family ID.
+func writeCondensation(file string, edges []victor.Edge, layout string) {
+	g := victor.Directed(edges, nil, 0, math.Inf(1))
+	sccOf := make(map[int64]sccNode)
+	var nodes []sccNode
+	for _, c := range topo.TarjanSCC(g) {
+		n := sccNode{members: make([]int64, len(c))}
+		for i, u := range c {
+			n.members[i] = u.ID()
+		}
+		sort.Slice(n.members, func(i, j int) bool { return n.members[i] < n.members[j] })
+		n.id = n.members[0]
+		for _, id := range n.members {
+			sccOf[id] = n
+		}
+		nodes = append(nodes, n)
+	}
+
+	weight := make(map[[2]int64]float64)
 	for _, e := range edges {
-		for _, n := range []graph.Node{e.From(), e.To()} {
-			if !g.Has(n) {
-				g.AddNode(n)
+		uv := [2]int64{sccOf[e.F.ID()].id, sccOf[e.T.ID()].id}
+		if uv[0] == uv[1] {
+			continue
+		}
+		weight[uv] = math.Max(weight[uv], e.W)
+	}
+
+	var hint dotLayout
+	if layout != "" {
+		hint.graph = dotAttrs{{"layout", layout}, {"overlap", "false"}}
+	}
+	cg := directedDOT{simple.NewWeightedDirectedGraph(0, math.Inf(1)), hint}
+	for _, n := range nodes {
+		cg.AddNode(n)
+	}
+	for uv, w := range weight {
+		cg.SetWeightedEdge(sccEdge{from: sccOf[uv[0]], to: sccOf[uv[1]], weight: w})
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q condensation DOT output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b, err := dot.Marshal(cg, "", "", "  ", false)
+	if err != nil {
+		log.Printf("failed to create condensation DOT bytes: %v", err)
+		return
+	}
+	_, err = f.Write(b)
+	if err != nil {
+		log.Printf("failed to write condensation DOT: %v", err)
+	}
+}
+
+// writeComponentDOTs writes the graph of edges within each group in grps
+// to its own DOT file, cluster-<id>.dot, in the named directory, where id
+// is the identity of the highest ranked family in the group.
+func writeComponentDOTs(dir string, grps []victor.Group, edges []victor.Edge, symmetric bool, layout string, style dotStyle) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		log.Printf("failed to create %q DOT directory: %v", dir, err)
+		return
+	}
+	for _, g := range grps {
+		members := make(victor.IntSet)
+		for _, fam := range g.Members {
+			members.Add(fam.ID)
+		}
+		var within []victor.Edge
+		for _, e := range edges {
+			if members.Has(e.F.ID()) && members.Has(e.T.ID()) {
+				within = append(within, e)
+			}
+		}
+		writeDOT(filepath.Join(dir, fmt.Sprintf("cluster-%d.dot", g.PageRank[0].ID)), within, nil, symmetric, layout, style)
+	}
+}
+
+// bedPalette is the set of itemRgb colours used to distinguish
+// clusters in BED output. Unclustered families are drawn in black.
+var bedPalette = []string{
+	"228,26,28",
+	"55,126,184",
+	"77,175,74",
+	"152,78,163",
+	"255,127,0",
+	"166,86,40",
+	"247,129,191",
+	"0,139,139",
+}
+
+// clusterColours returns the bedPalette colour of each cluster
+// in cluster, keyed by cluster ID.
+func clusterColours(cluster map[int64]int64) map[int64]string {
+	// Assign colours in cluster ID order so that
+	// they are stable between runs.
+	var clusters []int64
+	seen := make(victor.IntSet)
+	for _, c := range cluster {
+		if !seen.Has(c) {
+			seen.Add(c)
+			clusters = append(clusters, c)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i] < clusters[j] })
+	colour := make(map[int64]string, len(clusters))
+	for i, c := range clusters {
+		colour[c] = bedPalette[i%len(bedPalette)]
+	}
+	return colour
+}
+
+// bedRecord is a single BED9 line.
+type bedRecord struct {
+	chr        string
+	start, end int
+	name       string
+	score      int
+	strand     seq.Strand
+	rgb        string
+}
+
+// byPosition sorts bedRecords by chromosome and then start position.
+type byPosition []bedRecord
+
+func (r byPosition) Len() int { return len(r) }
+func (r byPosition) Less(i, j int) bool {
+	if r[i].chr != r[j].chr {
+		return r[i].chr < r[j].chr
+	}
+	if r[i].start != r[j].start {
+		return r[i].start < r[j].start
+	}
+	return r[i].end < r[j].end
+}
+func (r byPosition) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+// writeBED writes the members of fams to the named file as coordinate
+// sorted BED9 with the family, cluster and clique annotations in the
+// name column, the scaled rank in the score column and the itemRgb
+// column coloured by cluster. If -bed-columns is 6, the thickStart,
+// thickEnd and itemRgb columns are omitted. Member coordinates are held
+// 0-based and half-open, so they are written to BED unchanged; the GFF
+// writer converts them to 1-based on output.
+func writeBED(file string, fams []victor.Family, ann annotations) {
+	colour := clusterColours(ann.cluster)
+
+	var recs []bedRecord
+	for _, fam := range fams {
+		name := fmt.Sprint(fam.ID)
+		rgb := "0,0,0"
+		if clustID, isClustered := ann.cluster[fam.ID]; isClustered {
+			name = fmt.Sprintf("%s:%d", name, clustID)
+			if clique := cliqueLabel(ann.clique[fam.ID], ann.cliqueMemberships[fam.ID]); clique != "" {
+				name = fmt.Sprintf("%s:%s", name, clique)
 			}
+			rgb = colour[clustID]
+		}
+		for _, m := range fam.Members {
+			recs = append(recs, bedRecord{chr: m.Chr, start: m.Start, end: m.End, name: name, score: ann.score[fam.ID], strand: m.Orient, rgb: rgb})
 		}
-		g.SetWeightedEdge(e)
 	}
+	sort.Sort(byPosition(recs))
 
-	familyIndexOf := make(map[int64]int, len(fams))
-	for i, f := range fams {
-		familyIndexOf[f.id] = i
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q BED output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	if *trackLine {
+		_, err = fmt.Fprintf(b, "track name=victor description=\"igor/victor families from %s\" itemRgb=\"On\"\n", *in)
+		if err != nil {
+			log.Printf("failed to write BED: %v", err)
+			return
+		}
 	}
-	var grps []group
-	r := community.Modularize(graph.Undirect{G: g}, resolution, rand.New(rand.NewSource(1)))
-	for _, c := range r.Communities() {
-		var grp group
-		for _, n := range c {
-			grp.members = append(grp.members, fams[familyIndexOf[n.ID()]])
+	for _, r := range recs {
+		if *bedCols == 6 {
+			_, err = fmt.Fprintf(b, "%s\t%d\t%d\t%s\t%d\t%s\n",
+				r.chr, r.start, r.end, r.name, r.score, r.strand)
+		} else {
+			_, err = fmt.Fprintf(b, "%s\t%d\t%d\t%s\t%d\t%s\t%d\t%d\t%s\n",
+				r.chr, r.start, r.end, r.name, r.score, r.strand, r.start, r.end, r.rgb)
+		}
+		if err != nil {
+			log.Printf("failed to write BED: %v", err)
+			return
 		}
-		if len(grp.members) == 2 || edgesIn(g, c)*2 == len(c)*(len(c)-1) {
-			grp.isClique = true
-		} else if cliques {
-			grp.cliques = cliquesIn(grp, edges, minSubClique)
+	}
+}
+
+// familyRecord is the JSON Lines representation of a family's annotations.
+type familyRecord struct {
+	ID      int64   `json:"id"`
+	Cluster *int64  `json:"cluster,omitempty"`
+	Clique  string  `json:"clique,omitempty"`
+	Rank    float64 `json:"rank,omitempty"`
+}
+
+// writeJSONL writes a JSON object holding the annotations of each
+// family in fams to the named file, one object per line. Records are
+// encoded one at a time rather than as an array, but the output is only
+// written once grouping is complete since a family's clique label
+// depends on its clique memberships in every cluster.
+func writeJSONL(file string, fams []victor.Family, ann annotations) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q JSON Lines output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	enc := json.NewEncoder(b)
+	for _, fam := range fams {
+		rec := familyRecord{ID: fam.ID}
+		if clustID, isClustered := ann.cluster[fam.ID]; isClustered {
+			rec.Cluster = &clustID
+			rec.Clique = cliqueLabel(ann.clique[fam.ID], ann.cliqueMemberships[fam.ID])
+			rec.Rank = ann.rank[fam.ID]
 		}
-		if len(grp.members) > 1 {
-			grp.pageRank = ranksOf(grp, edges)
+		err = enc.Encode(rec)
+		if err != nil {
+			log.Printf("failed to write JSON Lines: %v", err)
+			return
 		}
+	}
+}
 
-		grps = append(grps, grp)
+// writeCliqueCounts writes the number of cliques each family in fams
+// is a member of to the named file as a tab-delimited table with a
+// header line. Families in no clique are written with a count of zero.
+func writeCliqueCounts(file string, fams []victor.Family, memberships map[int64]int64) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q clique counts output file: %v", file, err)
+		return
 	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	_, err = fmt.Fprintln(b, "family_id\tclique_count")
+	if err != nil {
+		log.Printf("failed to write clique counts: %v", err)
+		return
+	}
+	for _, fam := range fams {
+		_, err = fmt.Fprintf(b, "%d\t%d\n", fam.ID, memberships[fam.ID])
+		if err != nil {
+			log.Printf("failed to write clique counts: %v", err)
+			return
+		}
+	}
+}
 
-	return grps
+// writeRepresentatives writes a line for each group in grps to the named
+// file holding the tab-delimited IDs of the members of the group in
+// descending PageRank order, so the first ID is the representative of
+// the cluster. Families without edges are not written.
+func writeRepresentatives(file string, grps []victor.Group) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q representatives output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	for _, g := range grps {
+		ids := make([]int64, len(g.PageRank))
+		for i, r := range g.PageRank {
+			ids[i] = r.ID
+		}
+		_, err = fmt.Fprintln(b, joined(ids, "\t"))
+		if err != nil {
+			log.Printf("failed to write representatives: %v", err)
+			return
+		}
+	}
 }
 
-type intset map[int64]struct{}
+// writeClusters writes a line for each group in grps to the named file
+// as a tab-delimited table with a header line. Each line holds the
+// cluster ID, the number of families and of members in the cluster,
+// the number of bases covered by the union of its members, the number
+// of chromosomes they lie on and whether the cluster is a clique.
+func writeClusters(file string, grps []victor.Group) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q clusters output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	_, err = fmt.Fprintln(b, "cluster_id\tfamilies\tmembers\tcovered_bp\tchromosomes\tis_clique")
+	if err != nil {
+		log.Printf("failed to write clusters: %v", err)
+		return
+	}
+	for _, g := range grps {
+		var members int
+		coords := make([][]victor.Feature, len(g.Members))
+		for i, fam := range g.Members {
+			members += len(fam.Members)
+			coords[i] = fam.Coords()
+		}
+		covered, err := victor.Coverage(coords...)
+		if err != nil {
+			log.Printf("failed to calculate coverage of cluster %d: %v", g.PageRank[0].ID, err)
+			continue
+		}
+		var bases int
+		for _, n := range covered {
+			bases += n
+		}
+		_, err = fmt.Fprintf(b, "%d\t%d\t%d\t%d\t%d\t%t\n", g.PageRank[0].ID, len(g.Members), members, bases, len(covered), g.IsClique)
+		if err != nil {
+			log.Printf("failed to write clusters: %v", err)
+			return
+		}
+	}
+}
 
-func (s intset) add(i int64) {
-	s[i] = struct{}{}
+// groupSummary is the JSON document written by -summary.
+type groupSummary struct {
+	Version string        `json:"version"`
+	Schema  int           `json:"schema"`
+	Groups  []groupRecord `json:"groups"`
 }
 
-func (s intset) has(i int64) bool {
-	_, ok := s[i]
-	return ok
+// groupRecord is the JSON representation of a group written by -summary.
+type groupRecord struct {
+	Members  []int64      `json:"members"`
+	IsClique bool         `json:"is_clique"`
+	Cliques  [][]int64    `json:"cliques,omitempty"`
+	PageRank []rankRecord `json:"pagerank"`
 }
 
-type twoset map[[2]int64]struct{}
+// rankRecord is the JSON representation of a family's PageRank.
+type rankRecord struct {
+	ID   int64   `json:"id"`
+	Rank float64 `json:"rank"`
+}
 
-func (s twoset) add(i, j int64) {
-	if i > j {
-		i, j = j, i
+// writeGroups writes the member IDs, clique status, sub-cliques and
+// PageRanks of each group in grps to the named file as a JSON object
+// that also holds the victor and schema versions. Sub-cliques are only present when they have been found with -cliques
+// or -weighted-cliques.
+func writeGroups(file string, grps []victor.Group) {
+	recs := make([]groupRecord, 0, len(grps))
+	for _, g := range grps {
+		rec := groupRecord{
+			Members:  make([]int64, len(g.Members)),
+			IsClique: g.IsClique,
+			Cliques:  g.Cliques,
+			PageRank: make([]rankRecord, len(g.PageRank)),
+		}
+		for i, m := range g.Members {
+			rec.Members[i] = m.ID
+		}
+		for i, r := range g.PageRank {
+			rec.PageRank[i] = rankRecord{ID: r.ID, Rank: r.Rank}
+		}
+		recs = append(recs, rec)
+	}
+
+	sum := groupSummary{Version: buildVersion(), Schema: schemaVersion, Groups: recs}
+	b, err := json.MarshalIndent(sum, "", "\t")
+	if err != nil {
+		log.Printf("failed to create group summary: %v", err)
+		return
+	}
+	err = os.WriteFile(file, append(b, '\n'), 0644)
+	if err != nil {
+		log.Printf("failed to write %q group summary: %v", file, err)
 	}
-	s[[2]int64{i, j}] = struct{}{}
 }
 
-func edgesIn(g graph.Directed, n []graph.Node) int {
-	in := make(intset)
-	for _, u := range n {
-		in.add(u.ID())
+// writePairs writes the pair similarities in pairs with an upper
+// intersection greater than cutoff to the named file as a tab-delimited
+// table with a header line. If raw is true the raw intersection of each
+// pair is written in an additional column.
+func writePairs(file string, pairs []victor.Similarity, cutoff float64, raw bool) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q pairs output file: %v", file, err)
+		return
 	}
-	seen := make(twoset)
-	// We could use graph.Undirect here, but the
-	// overhead increases and we don't actually
-	// need all the nodes, just the edges.
-	for _, u := range n {
-		uid := u.ID()
-		for _, v := range g.From(u) {
-			vid := v.ID()
-			if !in.has(vid) {
-				continue
-			}
-			seen.add(uid, vid)
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	header := "familyA\tfamilyB\tupper\tlower\tintersect_bp"
+	if raw {
+		header += "\traw_bp"
+	}
+	_, err = fmt.Fprintln(b, header)
+	if err != nil {
+		log.Printf("failed to write pairs: %v", err)
+		return
+	}
+	for _, p := range pairs {
+		if p.Upper <= cutoff {
+			continue
 		}
-		for _, v := range g.To(u) {
-			vid := v.ID()
-			if !in.has(vid) {
-				continue
-			}
-			seen.add(uid, vid)
+		var rawCol string
+		if raw {
+			rawCol = fmt.Sprintf("\t%d", p.Raw)
+		}
+		_, err = fmt.Fprintf(b, "%d\t%d\t%v\t%v\t%d%s\n", p.A, p.B, p.Upper, p.Lower, p.Intersect, rawCol)
+		if err != nil {
+			log.Printf("failed to write pairs: %v", err)
+			return
 		}
 	}
-	return len(seen)
 }
 
-func cliquesIn(grp group, edges []edge, min int) [][]int64 {
-	members := make(intset)
-	for _, fam := range grp.members {
-		members.add(fam.id)
+// writeEdgeTable writes the pair similarities in pairs with an upper
+// intersection greater than or equal to thresh to the named file as
+// CSV with a header line. Each pair is written from the shorter family
+// to the longer family with the length of each.
+func writeEdgeTable(file string, fams []victor.Family, pairs []victor.Similarity, thresh float64) {
+	familyIndexOf := make(map[int64]int, len(fams))
+	for i, fam := range fams {
+		familyIndexOf[fam.ID] = i
 	}
 
-	g := simple.NewUndirectedGraph()
-outer:
-	for _, e := range edges {
-		for _, n := range []graph.Node{e.From(), e.To()} {
-			if !members.has(n.ID()) {
-				continue outer
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q edge table output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	_, err = fmt.Fprintln(b, "from_family,to_family,upper,lower,from_length,to_length")
+	if err != nil {
+		log.Printf("failed to write edge table: %v", err)
+		return
+	}
+	for _, p := range pairs {
+		if p.Upper < thresh || math.IsNaN(p.Upper) {
+			continue
+		}
+		from, to := fams[familyIndexOf[p.A]], fams[familyIndexOf[p.B]]
+		if from.Size() > to.Size() {
+			from, to = to, from
+		}
+		_, err = fmt.Fprintf(b, "%d,%d,%v,%v,%d,%d\n", from.ID, to.ID, p.Upper, p.Lower, from.Length, to.Length)
+		if err != nil {
+			log.Printf("failed to write edge table: %v", err)
+			return
+		}
+	}
+}
+
+// writeDistances writes the condensed distance matrix of fams to the
+// named file, one distance per line in the order expected by scipy's
+// squareform and linkage functions. The distance between a pair of
+// families is one minus their edge weight found by c, the upper
+// intersection unless -metric, -metric-weights or -reciprocal is given.
+// The family ID order of the matrix is written as a leading comment line.
+func writeDistances(file string, c *victor.Connector, fams []victor.Family, pairs []victor.Similarity) {
+	similarity := similarities(c, pairs)
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q distance output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	fmt.Fprint(b, "#")
+	for _, fam := range fams {
+		fmt.Fprintf(b, " %d", fam.ID)
+	}
+	_, err = fmt.Fprintln(b)
+	if err != nil {
+		log.Printf("failed to write distances: %v", err)
+		return
+	}
+	for i, a := range fams {
+		for _, c := range fams[i+1:] {
+			_, err = fmt.Fprintln(b, 1-similarity[[2]int64{a.ID, c.ID}])
+			if err != nil {
+				log.Printf("failed to write distances: %v", err)
+				return
 			}
 		}
-		for _, n := range []graph.Node{e.From(), e.To()} {
-			if !g.Has(n) {
-				g.AddNode(n)
+	}
+}
+
+// writeLaplacian writes the weighted Laplacian of the graph of edges
+// over the families in fams to the named file in Matrix Market symmetric
+// coordinate format. The adjacency of a pair of families is the greatest
+// weight of the edges between them. Rows and columns are in the order of
+// fams, which is written as a comment line.
+func writeLaplacian(file string, fams []victor.Family, edges []victor.Edge) {
+	index := make(map[int64]int, len(fams))
+	for i, fam := range fams {
+		index[fam.ID] = i
+	}
+	adj := make(map[[2]int]float64)
+	for _, e := range edges {
+		i, j := index[e.F.ID()], index[e.T.ID()]
+		if i < j {
+			i, j = j, i
+		}
+		adj[[2]int{i, j}] = math.Max(adj[[2]int{i, j}], e.W)
+	}
+	degree := make([]float64, len(fams))
+	for ij, w := range adj {
+		degree[ij[0]] += w
+		degree[ij[1]] += w
+	}
+	entries := make([][2]int, 0, len(adj))
+	for ij := range adj {
+		entries = append(entries, ij)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a][1] != entries[b][1] {
+			return entries[a][1] < entries[b][1]
+		}
+		return entries[a][0] < entries[b][0]
+	})
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q Laplacian output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	fmt.Fprintln(b, "%%MatrixMarket matrix coordinate real symmetric")
+	fmt.Fprint(b, "%")
+	for _, fam := range fams {
+		fmt.Fprintf(b, " %d", fam.ID)
+	}
+	fmt.Fprintln(b)
+	_, err = fmt.Fprintf(b, "%d %d %d\n", len(fams), len(fams), len(fams)+len(entries))
+	if err != nil {
+		log.Printf("failed to write Laplacian: %v", err)
+		return
+	}
+	// Entries are written in column-major order of the lower triangle.
+	next := 0
+	for j := range fams {
+		_, err = fmt.Fprintf(b, "%d %d %v\n", j+1, j+1, degree[j])
+		if err != nil {
+			log.Printf("failed to write Laplacian: %v", err)
+			return
+		}
+		for ; next < len(entries) && entries[next][1] == j; next++ {
+			ij := entries[next]
+			_, err = fmt.Fprintf(b, "%d %d %v\n", ij[0]+1, j+1, -adj[ij])
+			if err != nil {
+				log.Printf("failed to write Laplacian: %v", err)
+				return
 			}
 		}
-		g.SetEdge(e)
 	}
+}
 
-	clqs := topo.BronKerbosch(g)
-	var cliqueIDs [][]int64
-	for _, clq := range clqs {
-		if len(clq) < min {
+// writeAdjacency writes the weighted adjacency matrix of the directed
+// graph of edges over the families in fams to the named file in Matrix
+// Market general coordinate format. The entry in row i and column j is
+// the weight of the first edge from family i to family j. Rows and
+// columns are in the order of fams, which is written as a comment line.
+func writeAdjacency(file string, fams []victor.Family, edges []victor.Edge) {
+	index := make(map[int64]int, len(fams))
+	for i, fam := range fams {
+		index[fam.ID] = i
+	}
+	adj := make(map[[2]int]float64)
+	var entries [][2]int
+	for _, e := range edges {
+		ij := [2]int{index[e.F.ID()], index[e.T.ID()]}
+		if _, ok := adj[ij]; ok {
 			continue
 		}
-		ids := make([]int64, 0, len(clq))
-		for _, n := range clq {
-			ids = append(ids, n.ID())
+		adj[ij] = e.W
+		entries = append(entries, ij)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a][1] != entries[b][1] {
+			return entries[a][1] < entries[b][1]
+		}
+		return entries[a][0] < entries[b][0]
+	})
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q adjacency output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	fmt.Fprintln(b, "%%MatrixMarket matrix coordinate real general")
+	fmt.Fprint(b, "%")
+	for _, fam := range fams {
+		fmt.Fprintf(b, " %d", fam.ID)
+	}
+	fmt.Fprintln(b)
+	_, err = fmt.Fprintf(b, "%d %d %d\n", len(fams), len(fams), len(entries))
+	if err != nil {
+		log.Printf("failed to write adjacency: %v", err)
+		return
+	}
+	// Entries are written in column-major order.
+	for _, ij := range entries {
+		_, err = fmt.Fprintf(b, "%d %d %v\n", ij[0]+1, ij[1]+1, adj[ij])
+		if err != nil {
+			log.Printf("failed to write adjacency: %v", err)
+			return
 		}
-		cliqueIDs = append(cliqueIDs, ids)
 	}
+}
 
-	return cliqueIDs
+// similarities returns a symmetric lookup by family ID pair of the edge
+// weight found by c for each pair, as described for Connector.Weight.
+func similarities(c *victor.Connector, pairs []victor.Similarity) map[[2]int64]float64 {
+	sim := make(map[[2]int64]float64, 2*len(pairs))
+	for _, p := range pairs {
+		w := c.Weight(p)
+		sim[[2]int64{p.A, p.B}] = w
+		sim[[2]int64{p.B, p.A}] = w
+	}
+	return sim
 }
 
-func ranksOf(grp group, edges []edge) ranks {
-	members := make(intset)
-	for _, fam := range grp.members {
-		members.add(fam.id)
+// writeCoverage writes the number of bases on each chromosome covered
+// by the union of all families in fams to the named file. If chromLen
+// holds the length of a chromosome, the covered fraction is also given,
+// otherwise the length and fraction are written as NA.
+func writeCoverage(file string, fams []victor.Family, chromLen map[string]int) {
+	members := make([][]victor.Feature, len(fams))
+	for i, fam := range fams {
+		members[i] = fam.Coords()
 	}
+	covered, err := victor.Coverage(members...)
+	if err != nil {
+		log.Printf("failed to calculate coverage: %v", err)
+		return
+	}
+	chrs := make([]string, 0, len(covered))
+	for chr := range covered {
+		chrs = append(chrs, chr)
+	}
+	sort.Strings(chrs)
 
-	g := simple.NewWeightedDirectedGraph(0, math.Inf(1))
-outer:
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q coverage output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
+	for _, chr := range chrs {
+		if n, ok := chromLen[chr]; ok {
+			_, err = fmt.Fprintf(b, "%s\t%d\t%d\t%v\n", chr, covered[chr], n, float64(covered[chr])/float64(n))
+		} else {
+			_, err = fmt.Fprintf(b, "%s\t%d\tNA\tNA\n", chr, covered[chr])
+		}
+		if err != nil {
+			log.Printf("failed to write coverage: %v", err)
+			return
+		}
+	}
+}
+
+// writeBEDPE writes an edge from edges to the named file as a BEDPE line
+// pairing the most overlapping members of the two families, with the
+// edge weight as the score.
+func writeBEDPE(file string, fams []victor.Family, edges []victor.Edge) {
+	familyIndexOf := make(map[int64]int, len(fams))
+	for i, f := range fams {
+		familyIndexOf[f.ID] = i
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Printf("failed to create %q BEDPE output file: %v", file, err)
+		return
+	}
+	defer f.Close()
+	b := bufio.NewWriter(f)
+	defer b.Flush()
 	for _, e := range edges {
-		for _, n := range []graph.Node{e.From(), e.To()} {
-			if !members.has(n.ID()) {
-				continue outer
-			}
+		a, c := representatives(fams[familyIndexOf[e.F.ID()]], fams[familyIndexOf[e.T.ID()]])
+		_, err = fmt.Fprintf(b, "%s\t%d\t%d\t%s\t%d\t%d\t%d:%d\t%v\t%s\t%s\n",
+			a.Chr, a.Start, a.End, c.Chr, c.Start, c.End, e.F.ID(), e.T.ID(), e.W, a.Orient, c.Orient)
+		if err != nil {
+			log.Printf("failed to write BEDPE: %v", err)
+			return
 		}
-		for _, n := range []graph.Node{e.From(), e.To()} {
-			if !g.Has(n) {
-				g.AddNode(n)
+	}
+}
+
+// representatives returns the pair of members of a and b that have the
+// greatest overlap. If no members overlap, the first member of each is
+// returned.
+func representatives(a, b victor.Family) (victor.Feature, victor.Feature) {
+	ra, rb := a.Members[0], b.Members[0]
+	var best int
+	for _, fa := range a.Members {
+		for _, fb := range b.Members {
+			if fa.Chr != fb.Chr {
+				continue
+			}
+			overlap := min(fa.End, fb.End) - max(fa.Start, fb.Start)
+			if overlap > best {
+				best = overlap
+				ra, rb = fa, fb
 			}
 		}
-		g.SetWeightedEdge(e)
 	}
+	return ra, rb
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
 
-	r := network.PageRank(g, 0.85, 1e-6)
-	o := make(ranks, 0, len(r))
-	for id, rnk := range r {
-		o = append(o, rank{id: id, rank: rnk})
+func max(a, b int) int {
+	if a > b {
+		return a
 	}
-	sort.Sort(o)
-	return o
+	return b
 }
 
-type rank struct {
-	id   int64
-	rank float64
+// scaledRanks returns the PageRank of each clustered family mapped onto
+// the integer range [0, 1000] relative to the minimum and maximum ranks
+// within its group. If scale is "log", ranks are log transformed before
+// mapping.
+func scaledRanks(grps []victor.Group, scale string) map[int64]int {
+	tr := func(r float64) float64 { return r }
+	if scale == "log" {
+		tr = math.Log
+	}
+	score := make(map[int64]int)
+	for _, g := range grps {
+		if len(g.PageRank) == 0 {
+			continue
+		}
+		// Ranks are sorted in descending order.
+		max := tr(g.PageRank[0].Rank)
+		min := tr(g.PageRank[len(g.PageRank)-1].Rank)
+		for _, r := range g.PageRank {
+			if max == min {
+				score[r.ID] = 1000
+				continue
+			}
+			score[r.ID] = int(math.Round(1000 * (tr(r.Rank) - min) / (max - min)))
+		}
+	}
+	return score
 }
 
-type ranks []rank
+// maxEdges returns the greatest weight of the edges incident on each
+// connected family mapped onto the integer range [0, 1000], with weights
+// above 1 given the maximum score.
+func maxEdges(edges []victor.Edge) map[int64]int {
+	max := make(map[int64]float64)
+	for _, e := range edges {
+		for _, id := range []int64{e.F.ID(), e.T.ID()} {
+			if w, ok := max[id]; !ok || e.W > w {
+				max[id] = e.W
+			}
+		}
+	}
+	score := make(map[int64]int, len(max))
+	for id, w := range max {
+		score[id] = int(math.Round(1000 * math.Min(w, 1)))
+	}
+	return score
+}
 
-func (o ranks) Len() int { return len(o) }
-func (o ranks) Less(i, j int) bool {
-	return o[i].rank > o[j].rank || (o[i].rank == o[j].rank && o[i].id < o[j].id)
+// confidences returns the confidence of the cluster assignment of each
+// family in a group of more than one member. The confidence is the mean
+// over the other members of the group of the greater edge weight joining
+// the family to that member, with unconnected members contributing zero,
+// so a family attached by a single weak edge has a low confidence.
+func confidences(grps []victor.Group, edges []victor.Edge) map[int64]float64 {
+	weight := make(map[[2]int64]float64)
+	for _, e := range edges {
+		u, v := e.F.ID(), e.T.ID()
+		if u > v {
+			u, v = v, u
+		}
+		weight[[2]int64{u, v}] = math.Max(weight[[2]int64{u, v}], e.W)
+	}
+	conf := make(map[int64]float64)
+	for _, g := range grps {
+		if len(g.Members) < 2 {
+			continue
+		}
+		for _, a := range g.Members {
+			var sum float64
+			for _, b := range g.Members {
+				u, v := a.ID, b.ID
+				if u > v {
+					u, v = v, u
+				}
+				sum += weight[[2]int64{u, v}]
+			}
+			conf[a.ID] = sum / float64(len(g.Members)-1)
+		}
+	}
+	return conf
 }
-func (o ranks) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
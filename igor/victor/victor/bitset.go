@@ -0,0 +1,105 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import "math/bits"
+
+// BitsetMax is the total genome length below which bitset coverage is
+// used automatically.
+const BitsetMax = 50e6
+
+// strandBits holds the coverage of a family on a chromosome by strand
+// as bitsets. Bit i of word j corresponds to position 64*(offset+j)+i.
+type strandBits struct {
+	offset            int
+	plus, minus, none []uint64
+}
+
+// word returns the words at index w of the strand bitsets, or
+// zeros if w is outside the bitsets.
+func (s *strandBits) word(w int) (plus, minus, none uint64) {
+	w -= s.offset
+	if w < 0 || w >= len(s.plus) {
+		return 0, 0, 0
+	}
+	return s.plus[w], s.minus[w], s.none[w]
+}
+
+// FamilyBits is the per-chromosome bitset coverage of a family.
+type FamilyBits map[string]*strandBits
+
+// NewFamilyBits returns the bitset coverage of the features in v, which
+// have the given extents.
+func NewFamilyBits(v []Feature, ext map[string]Extent) FamilyBits {
+	fb := make(FamilyBits, len(ext))
+	for chr, e := range ext {
+		lo, hi := e.Start/64, (e.End-1)/64+1
+		fb[chr] = &strandBits{
+			offset: lo,
+			plus:   make([]uint64, hi-lo),
+			minus:  make([]uint64, hi-lo),
+			none:   make([]uint64, hi-lo),
+		}
+	}
+	for _, f := range v {
+		sb := fb[f.Chr]
+		var set []uint64
+		switch strandOf(f.Orient) {
+		case plusStrand:
+			set = sb.plus
+		case minusStrand:
+			set = sb.minus
+		default:
+			set = sb.none
+		}
+		setRange(set, f.Start-64*sb.offset, f.End-64*sb.offset)
+	}
+	return fb
+}
+
+// setRange sets the bits in [start, end) of b.
+func setRange(b []uint64, start, end int) {
+	for start < end {
+		w, i := start/64, uint(start%64)
+		n := 64 - int(i)
+		if end-start < n {
+			n = end - start
+		}
+		mask := ^uint64(0)
+		if n < 64 {
+			mask = (1<<uint(n) - 1) << i
+		}
+		b[w] |= mask
+		start += n
+	}
+}
+
+// BitsetIntersection returns the intersection of a and b calculated
+// from their bitset coverage. Its results are identical to those of
+// intersection.
+func BitsetIntersection(a, b Family, o Orientation) (upper, lower float64, intersect int) {
+	var agreed int
+	for chr, x := range a.Bits {
+		y, ok := b.Bits[chr]
+		if !ok {
+			continue
+		}
+		lo := max(x.offset, y.offset)
+		hi := min(x.offset+len(x.plus), y.offset+len(y.plus))
+		for w := lo; w < hi; w++ {
+			xp, xm, xn := x.word(w)
+			yp, ym, yn := y.word(w)
+			xc, yc := xp|xm|xn, yp|ym|yn
+			both := xc & yc
+			agree := xp&yp | xm&ym
+			if o.UnknownAgrees {
+				agree |= xn&yc | yn&xc
+			}
+			intersect += bits.OnesCount64(both)
+			agreed += bits.OnesCount64(agree & both)
+		}
+	}
+	return fractions(a, b, agreed, intersect, o)
+}
@@ -0,0 +1,64 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import "runtime"
+
+// ClusterConfig specifies the parameters for a clusterer.
+type ClusterConfig struct {
+	Thresh float64
+	GroupConfig
+
+	// Similarity is used to connect families.
+	// If it is nil, families are connected when
+	// their intersection passes Thresh.
+	Similarity SimilarityFunc
+}
+
+// Clusterer incrementally groups families as they are added.
+type Clusterer struct {
+	cfg ClusterConfig
+
+	conn     *Connector
+	families []Family
+}
+
+// NewClusterer returns a clusterer using the given grouping parameters.
+func NewClusterer(cfg ClusterConfig) *Clusterer {
+	conn := NewConnector(runtime.GOMAXPROCS(0))
+	conn.Orient = Orientation{Penalty: 1, UnknownAgrees: true}
+	conn.Similar = cfg.Similarity
+	return &Clusterer{cfg: cfg, conn: conn}
+}
+
+// Add adds fam to the clusterer, connecting it with the families
+// already held. The length of fam must have been calculated. The
+// extents of fam are calculated if they are nil so that families on
+// disjoint chromosomes are not compared. If an error is returned fam
+// is not added.
+func (c *Clusterer) Add(fam Family) error {
+	if fam.Extents == nil {
+		fam.Extents = Extents(fam.Coords())
+	}
+	_, err := c.conn.EdgesWith(c.families, fam, c.cfg.Thresh)
+	if err != nil {
+		return err
+	}
+	c.families = append(c.families, fam)
+	return nil
+}
+
+// Clusters returns the current grouping of the families that have
+// been added. It returns an error if the configured clustering method
+// is not known.
+//
+// The grouping is currently recalculated from the complete edge set
+// on each call.
+func (c *Clusterer) Clusters() ([]Group, error) {
+	c.conn.mu.Lock()
+	edges := c.conn.edges
+	c.conn.mu.Unlock()
+	return Groups(c.families, edges, c.cfg.GroupConfig)
+}
@@ -0,0 +1,209 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"math/rand"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// Random streams for randomised steps. New randomised steps should
+// be given a new stream rather than sharing an existing one.
+const (
+	clusterStream = iota
+)
+
+// newRand returns a random source for the randomised step using the
+// given stream. Each stream is derived from seed, so results are
+// reproducible for a seed and adding a randomised step does not
+// change the results of others.
+func newRand(seed int64, stream int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed ^ stream<<32))
+}
+
+// labelPropagation returns the communities found by asynchronous label
+// propagation over the graph of edges, treating edges as undirected with
+// the weights of reciprocal edges summed. Nodes are visited in a random
+// order drawn from src each round, and each takes the label with the
+// greatest summed weight among its neighbours, with ties broken by src.
+// Propagation stops when no label changes or after maxRounds rounds.
+func labelPropagation(edges []Edge, src *rand.Rand) [][]graph.Node {
+	const maxRounds = 100
+
+	nodes := make(map[int64]graph.Node)
+	adj := make(map[int64]map[int64]float64)
+	for _, e := range edges {
+		u, v := e.F.ID(), e.T.ID()
+		if u == v {
+			continue
+		}
+		nodes[u] = e.F
+		nodes[v] = e.T
+		for _, uv := range [][2]int64{{u, v}, {v, u}} {
+			if adj[uv[0]] == nil {
+				adj[uv[0]] = make(map[int64]float64)
+			}
+			adj[uv[0]][uv[1]] += e.W
+		}
+	}
+	ids := make([]int64, 0, len(nodes))
+	label := make(map[int64]int64, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+		label[id] = id
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	// Neighbours are visited in ID order so that
+	// summed label weights do not depend on map
+	// iteration order.
+	neighbours := make(map[int64][]int64, len(adj))
+	for u, a := range adj {
+		n := make([]int64, 0, len(a))
+		for v := range a {
+			n = append(n, v)
+		}
+		sort.Slice(n, func(i, j int) bool { return n[i] < n[j] })
+		neighbours[u] = n
+	}
+
+	var best []int64
+	for round := 0; round < maxRounds; round++ {
+		changed := false
+		for _, i := range src.Perm(len(ids)) {
+			u := ids[i]
+			weight := make(map[int64]float64)
+			for _, v := range neighbours[u] {
+				weight[label[v]] += adj[u][v]
+			}
+			best = best[:0]
+			max := 0.0
+			for l, w := range weight {
+				switch {
+				case w > max:
+					max = w
+					best = append(best[:0], l)
+				case w == max:
+					best = append(best, l)
+				}
+			}
+			if len(best) == 0 {
+				continue
+			}
+			// Sort candidates so that the choice depends
+			// only on src and not on map iteration order.
+			sort.Slice(best, func(i, j int) bool { return best[i] < best[j] })
+			l := best[src.Intn(len(best))]
+			if l != label[u] {
+				label[u] = l
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	index := make(map[int64]int)
+	var communities [][]graph.Node
+	for _, id := range ids {
+		l := label[id]
+		c, ok := index[l]
+		if !ok {
+			c = len(communities)
+			index[l] = c
+			communities = append(communities, nil)
+		}
+		communities[c] = append(communities[c], nodes[id])
+	}
+	return communities
+}
+
+// percolated returns the k-clique percolation communities formed by
+// the cliques in clqs, each of which must have at least k members.
+// Cliques are in the same community when they are connected by a chain
+// of cliques each sharing at least k-1 members with the next. A
+// family may belong to more than one community.
+func percolated(clqs [][]int64, k int) [][]int64 {
+	parent := make([]int, len(clqs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	sets := make([]IntSet, len(clqs))
+	for i, clq := range clqs {
+		sets[i] = make(IntSet)
+		for _, id := range clq {
+			sets[i].Add(id)
+		}
+	}
+	for i := range clqs {
+		for j := i + 1; j < len(clqs); j++ {
+			var shared int
+			for _, id := range clqs[j] {
+				if sets[i].Has(id) {
+					shared++
+				}
+			}
+			if shared >= k-1 {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := make(map[int]IntSet)
+	var roots []int
+	for i, clq := range clqs {
+		r := find(i)
+		if members[r] == nil {
+			members[r] = make(IntSet)
+			roots = append(roots, r)
+		}
+		for _, id := range clq {
+			members[r].Add(id)
+		}
+	}
+	communities := make([][]int64, 0, len(roots))
+	for _, r := range roots {
+		c := make([]int64, 0, len(members[r]))
+		for id := range members[r] {
+			c = append(c, id)
+		}
+		communities = append(communities, c)
+	}
+	return communities
+}
+
+// groupIDs returns the family IDs of the members of grp.
+func groupIDs(grp Group) []int64 {
+	ids := make([]int64, len(grp.Members))
+	for i, m := range grp.Members {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+// rankOrdered returns the IDs in ids ordered by their rank in r.
+func rankOrdered(r Ranks, ids []int64) []int64 {
+	has := make(IntSet)
+	for _, id := range ids {
+		has.Add(id)
+	}
+	o := make([]int64, 0, len(ids))
+	for _, m := range r {
+		if has.Has(m.ID) {
+			o = append(o, m.ID)
+		}
+	}
+	return o
+}
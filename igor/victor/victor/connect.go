@@ -0,0 +1,394 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Connector handles parallel analysis of family intersections.
+type Connector struct {
+	wg sync.WaitGroup
+
+	mu    sync.Mutex
+	edges []Edge
+
+	// order holds the index of the comparison
+	// that found each edge and pair so that
+	// they can be returned in comparison order
+	// however the comparisons are scheduled.
+	order     []int
+	pairOrder []int
+
+	// Pairs holds the intersections of all
+	// intersecting pairs when KeepPairs is true.
+	KeepPairs bool
+	Pairs     []Similarity
+
+	// limit specifies the maximum number
+	// of concurrent intersection calls.
+	limit chan struct{}
+
+	// Evaluated is the number of family
+	// pairs that have been compared.
+	Evaluated int
+
+	// err is the first error encountered
+	// while comparing families.
+	err error
+
+	// Log receives a line for each edge
+	// added if it is not nil.
+	Log io.Writer
+
+	// Stream is called with each edge as
+	// it is added if it is not nil.
+	Stream func(Edge)
+
+	// Orient specifies how strand agreement
+	// affects intersection.
+	Orient Orientation
+
+	// Similar is used in place of intersection
+	// to connect families if it is not nil.
+	// Pairs are then not recorded, and Combine,
+	// Composite, Reciprocal and LowerThresh do
+	// not apply.
+	Similar SimilarityFunc
+
+	// Combine is used to collapse reciprocal
+	// edges into a single edge from the shorter
+	// family to the longer if it is not nil.
+	// The collapsed edge is directed, so the
+	// PageRanks returned by RanksOf for the
+	// pair differ from those of the reciprocal
+	// edges it replaces.
+	Combine func(upper, lower float64) float64
+
+	// Composite is used to give a single edge
+	// from the shorter family to the longer a
+	// composite weight if it is not nil.
+	Composite Composite
+
+	// Reciprocal specifies that only pairs
+	// whose lower intersection passes the
+	// threshold are joined, by a single edge
+	// weighted by the lower intersection.
+	Reciprocal bool
+
+	// LowerThresh is used in place of the
+	// threshold to decide whether the lower
+	// intersection of a pair adds a reciprocal
+	// edge if it is not nil.
+	LowerThresh *float64
+
+	// Weighted specifies that intersections
+	// are weighted by member weights.
+	Weighted bool
+
+	// Raw specifies that the raw intersection
+	// is calculated for weighted intersections.
+	Raw bool
+}
+
+// NewConnector returns a connector that runs at most threads
+// concurrent intersection calls.
+func NewConnector(threads int) *Connector {
+	return &Connector{limit: make(chan struct{}, threads)}
+}
+
+// SimilarityFunc is a family similarity function. It returns the weight
+// of the edge from the shorter of a and b to the longer and whether the
+// edge exists. Edges with a NaN weight are not added.
+type SimilarityFunc func(a, b Family) (weight float64, ok bool)
+
+// acquire gets an available worker thread.
+func (c *Connector) acquire() {
+	c.wg.Add(1)
+	c.limit <- struct{}{}
+}
+
+// release puts pack a worker thread.
+func (c *Connector) release() {
+	<-c.limit
+	c.wg.Done()
+}
+
+// connect adds e found by the comparison with index n to the store
+// of edges.
+func (c *Connector) connect(e Edge, n int) {
+	c.mu.Lock()
+	if c.Log != nil {
+		fmt.Fprintln(c.Log, e.F.ID(), e.T.ID(), e.W)
+	}
+	if c.Stream != nil {
+		c.Stream(e)
+	}
+	c.edges = append(c.edges, e)
+	c.order = append(c.order, n)
+	c.mu.Unlock()
+}
+
+// record adds s found by the comparison with index n to the store
+// of pair similarities if the pair intersects.
+func (c *Connector) record(s Similarity, n int) {
+	if !c.KeepPairs || s.Intersect == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.Pairs = append(c.Pairs, s)
+	c.pairOrder = append(c.pairOrder, n)
+	c.mu.Unlock()
+}
+
+// fail records err if it is the first error encountered.
+func (c *Connector) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+}
+
+// collect puts the edges and pairs held by c into comparison order
+// and returns the edges and the first error encountered. It must be
+// called with c.mu held once all comparisons are complete.
+func (c *Connector) collect() ([]Edge, error) {
+	edges := make([]Edge, len(c.edges))
+	for i, j := range ordered(c.order) {
+		edges[i] = c.edges[j]
+	}
+	c.edges = edges
+	sort.Ints(c.order)
+	if c.KeepPairs {
+		pairs := make([]Similarity, len(c.Pairs))
+		for i, j := range ordered(c.pairOrder) {
+			pairs[i] = c.Pairs[j]
+		}
+		c.Pairs = pairs
+		sort.Ints(c.pairOrder)
+	}
+	return c.edges, c.err
+}
+
+// ordered returns the indices of order sorted stably by their values.
+func ordered(order []int) []int {
+	idx := make([]int, len(order))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return order[idx[i]] < order[idx[j]] })
+	return idx
+}
+
+// EdgesFor returns the edges that exist between families in f where
+// the intersection is greater than or equal to thresh, and the first
+// error encountered while comparing families.
+func (c *Connector) EdgesFor(f []Family, thresh float64) ([]Edge, error) {
+	for i, a := range f[:len(f)-1] {
+		for _, b := range f[i+1:] {
+			c.compare(a, b, thresh)
+		}
+	}
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.collect()
+}
+
+// EdgesAmong returns the edges that exist between the pairs of families
+// in f with the indices in pairs where the intersection is greater than
+// or equal to thresh, and the first error encountered while comparing
+// families.
+func (c *Connector) EdgesAmong(f []Family, pairs [][2]int, thresh float64) ([]Edge, error) {
+	for _, p := range pairs {
+		c.compare(f[p[0]], f[p[1]], thresh)
+	}
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.collect()
+}
+
+// EdgesWith adds the edges that exist between a and the families in f
+// where the intersection is greater than or equal to thresh, and returns
+// all the edges held by c and the first error encountered while comparing
+// families. If an error is returned, no edges or pairs are added and c
+// is left as it was before the call.
+func (c *Connector) EdgesWith(f []Family, a Family, thresh float64) ([]Edge, error) {
+	c.mu.Lock()
+	edges, pairs, evaluated := len(c.edges), len(c.Pairs), c.Evaluated
+	c.mu.Unlock()
+
+	for _, b := range f {
+		c.compare(a, b, thresh)
+	}
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	all, err := c.collect()
+	if err != nil {
+		// Comparisons made by this call are ordered
+		// after those of earlier calls, so truncation
+		// removes only what this call added.
+		c.edges, c.order = c.edges[:edges], c.order[:edges]
+		c.Pairs, c.pairOrder = c.Pairs[:pairs], c.pairOrder[:pairs]
+		c.Evaluated = evaluated
+		c.err = nil
+		return c.edges, err
+	}
+	return all, nil
+}
+
+// compare concurrently finds the intersection of a and b and adds
+// the edges between them that pass thresh.
+func (c *Connector) compare(a, b Family, thresh float64) {
+	if a.Size() == 0 || b.Size() == 0 {
+		// Zero length families have no defined
+		// intersection.
+		return
+	}
+	if c.Similar == nil && a.Disjoint(b) {
+		// Families that do not overlap cannot
+		// intersect, so avoid building vectors.
+		return
+	}
+	n := c.Evaluated
+	c.Evaluated++
+	c.acquire()
+	go func() {
+		defer c.release()
+		if c.Similar != nil {
+			w, ok := c.Similar(a, b)
+			if !ok || math.IsNaN(w) {
+				return
+			}
+			if a.Size() > b.Size() {
+				a, b = b, a
+			}
+			c.connect(Edge{
+				F: NodeOf(a),
+				T: NodeOf(b),
+				W: w,
+			}, n)
+			return
+		}
+		var (
+			upper, lower   float64
+			intersect, raw int
+			err            error
+		)
+		switch {
+		case c.Weighted:
+			upper, lower, intersect, err = WeightedIntersection(a, b, c.Orient)
+			if err == nil && c.Raw {
+				_, _, _, raw, err = Intersection(a, b, c.Orient)
+			}
+		case a.Bits != nil && b.Bits != nil:
+			upper, lower, intersect = BitsetIntersection(a, b, c.Orient)
+		default:
+			upper, lower, intersect, raw, err = Intersection(a, b, c.Orient)
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.record(Similarity{A: a.ID, B: b.ID, Upper: upper, Lower: lower, Intersect: intersect, Raw: raw}, n)
+		c.link(a, b, upper, lower, thresh, n)
+	}()
+}
+
+// EdgesFrom returns the edges that exist between families in f where
+// the intersection held in pairs is greater than or equal to thresh.
+func (c *Connector) EdgesFrom(f []Family, pairs []Similarity, thresh float64) []Edge {
+	familyIndexOf := make(map[int64]int, len(f))
+	for i, fam := range f {
+		familyIndexOf[fam.ID] = i
+	}
+	c.edges = nil
+	c.order = nil
+	for i, p := range pairs {
+		c.link(f[familyIndexOf[p.A]], f[familyIndexOf[p.B]], p.Upper, p.Lower, thresh, i)
+	}
+	return c.edges
+}
+
+// Weight returns the weight compared with the threshold for the pair of
+// families with the similarity s. This is the composite weight if
+// Composite is not nil, the lower intersection if Reciprocal is true and
+// the upper intersection otherwise.
+func (c *Connector) Weight(s Similarity) float64 {
+	switch {
+	case c.Composite != nil:
+		return c.Composite.Weight(MetricsOf(s.Upper, s.Lower))
+	case c.Reciprocal:
+		return s.Lower
+	}
+	return s.Upper
+}
+
+// link adds the edges between a and b found by the comparison with
+// index n with the given upper and lower intersections that are greater
+// than or equal to thresh.
+func (c *Connector) link(a, b Family, upper, lower, thresh float64, n int) {
+	lowerThresh := thresh
+	if c.LowerThresh != nil {
+		lowerThresh = *c.LowerThresh
+	}
+	reciprocal := lower >= lowerThresh
+	if c.Composite != nil {
+		upper = c.Composite.Weight(MetricsOf(upper, lower))
+		reciprocal = false
+	}
+	if c.Reciprocal {
+		if !reciprocal {
+			return
+		}
+		upper, reciprocal = lower, false
+	}
+	// NaN weights fail the reciprocal test
+	// but must be explicitly excluded here.
+	if upper < thresh || math.IsNaN(upper) {
+		return
+	}
+
+	// Edges indicate connection from the shorter
+	// family to the longer family, so ensure this
+	// is the state now.
+	if a.Size() > b.Size() {
+		a, b = b, a
+	}
+
+	if reciprocal && c.Combine != nil {
+		upper = c.Combine(upper, lower)
+		reciprocal = false
+	}
+
+	c.connect(Edge{
+		F: NodeOf(a),
+		T: NodeOf(b),
+		W: upper,
+	}, n)
+
+	if !reciprocal {
+		return
+	}
+
+	c.connect(Edge{
+		F: NodeOf(b),
+		T: NodeOf(a),
+		W: lower,
+	}, n)
+}
@@ -0,0 +1,7 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package victor provides support for grouping repeat families based
+// on the intersection of their genomic coverage.
+package victor
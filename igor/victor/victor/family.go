@@ -0,0 +1,218 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+
+	"github.com/biogo/biogo/seq"
+	"github.com/biogo/store/step"
+)
+
+// Feature is a repeat family member.
+type Feature struct {
+	Chr    string     `json:"C"`
+	Start  int        `json:"S"`
+	End    int        `json:"E"`
+	Orient seq.Strand `json:"O"`
+	ID     string     `json:"I,omitempty"`
+	Weight *float64   `json:"W,omitempty"`
+}
+
+// Family is a repeat family. The Length of a family must be calculated
+// before it is compared with other families.
+type Family struct {
+	ID      int64
+	Members []Feature
+
+	// Length is the number of bases
+	// covered by the members.
+	Length int
+
+	// Name is the name of the family if
+	// the input format provides one.
+	Name string
+
+	// Bits holds the bitset coverage of the
+	// family if bitset intersection is used.
+	Bits FamilyBits
+
+	// Segments holds the merged coverage of
+	// the family used for intersection. It
+	// is calculated for each comparison if
+	// it is nil.
+	Segments Segments
+
+	// Grid holds the members used for
+	// calculating intersections, snapped to
+	// bins or merged, if they differ from the
+	// members used for output.
+	Grid []Feature
+
+	// RawLength is the sum of member lengths
+	// without merging overlapping members.
+	RawLength int
+
+	// Span is the sum of the extents of
+	// the family on each chromosome.
+	Span int
+
+	// Weight is the weighted length of
+	// the family in weighted analyses.
+	// It is only used if Weighted is true.
+	Weight   float64
+	Weighted bool
+
+	// Extents holds the extent of the family
+	// on each chromosome if it is not nil.
+	Extents map[string]Extent
+}
+
+// Size returns the weighted length of f if f is weighted and the
+// number of covered bases otherwise.
+func (f Family) Size() float64 {
+	if f.Weighted {
+		return f.Weight
+	}
+	return float64(f.Length)
+}
+
+// Coords returns the members of f used for calculating intersections.
+func (f Family) Coords() []Feature {
+	if f.Grid != nil {
+		return f.Grid
+	}
+	return f.Members
+}
+
+// Disjoint returns whether the extents of f and g do not overlap on
+// any chromosome. It returns false if either f or g has no extents.
+func (f Family) Disjoint(g Family) bool {
+	if f.Extents == nil || g.Extents == nil {
+		return false
+	}
+	for chr, e := range f.Extents {
+		o, ok := g.Extents[chr]
+		if ok && e.Start < o.End && o.Start < e.End {
+			return false
+		}
+	}
+	return true
+}
+
+// ByMembers sorts families by descending number of members and then
+// by ascending ID so that the order does not depend on the input order.
+type ByMembers []Family
+
+func (f ByMembers) Len() int { return len(f) }
+func (f ByMembers) Less(i, j int) bool {
+	if len(f[i].Members) != len(f[j].Members) {
+		return len(f[i].Members) > len(f[j].Members)
+	}
+	return f[i].ID < f[j].ID
+}
+func (f ByMembers) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+
+// stepBool is a bool type satisfying the step.Equaler interface.
+type stepBool bool
+
+// Equal returns whether b equals e. Equal assumes the underlying type of e is a stepBool.
+func (b stepBool) Equal(e step.Equaler) bool {
+	return b == e.(stepBool)
+}
+
+// Length returns the number of covered bases in v.
+func Length(v []Feature) (int, error) {
+	covered, err := Coverage(v)
+	if err != nil {
+		return 0, err
+	}
+	var len int
+	for _, n := range covered {
+		len += n
+	}
+	return len, nil
+}
+
+// RawLength returns the sum of the lengths of features in v.
+func RawLength(v []Feature) int {
+	var n int
+	for _, f := range v {
+		n += f.End - f.Start
+	}
+	return n
+}
+
+// Extent is the interval from the lowest start to the highest
+// end of a set of features on a chromosome.
+type Extent struct{ Start, End int }
+
+// Extents returns the extent of features in v on each chromosome.
+func Extents(v []Feature) map[string]Extent {
+	ext := make(map[string]Extent)
+	for _, f := range v {
+		e, ok := ext[f.Chr]
+		if !ok {
+			ext[f.Chr] = Extent{f.Start, f.End}
+			continue
+		}
+		ext[f.Chr] = Extent{min(e.Start, f.Start), max(e.End, f.End)}
+	}
+	return ext
+}
+
+// Span returns the sum over chromosomes of the lengths of the extents
+// in ext.
+func Span(ext map[string]Extent) int {
+	var n int
+	for _, e := range ext {
+		n += e.End - e.Start
+	}
+	return n
+}
+
+// Coverage returns the number of bases covered by the union of the
+// features in v for each chromosome.
+func Coverage(v ...[]Feature) (map[string]int, error) {
+	vecs := make(map[string]*step.Vector)
+	for _, fs := range v {
+		for _, f := range fs {
+			vec, ok := vecs[f.Chr]
+			if !ok {
+				var err error
+				vec, err = step.New(f.Start, f.End, stepBool(false))
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d-%d: %v", f.Chr, f.Start, f.End, err)
+				}
+				vec.Relaxed = true
+				vecs[f.Chr] = vec
+			}
+			vec.SetRange(f.Start, f.End, stepBool(true))
+		}
+	}
+	covered := make(map[string]int, len(vecs))
+	for chr, vec := range vecs {
+		vec.Do(func(start, end int, e step.Equaler) {
+			if e.(stepBool) {
+				covered[chr] += end - start
+			}
+		})
+	}
+	return covered, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,195 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+	"strconv"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// Node is a family graph node.
+type Node struct {
+	id      int64
+	Name    string
+	Cluster int64
+	Members int
+}
+
+var _ encoding.Attributer = Node{}
+
+func (n Node) ID() int64 { return n.id }
+func (n Node) Attributes() []encoding.Attribute {
+	var attrs []encoding.Attribute
+	// Unnamed nodes are labelled with
+	// their ID by default.
+	if n.Name != "" {
+		attrs = append(attrs, encoding.Attribute{"label", strconv.Quote(n.Name)})
+	}
+	if n.Cluster != -1 {
+		attrs = append(attrs, encoding.Attribute{"cluster", fmt.Sprint(n.Cluster)})
+	}
+	return append(attrs, encoding.Attribute{"members", fmt.Sprint(n.Members)})
+}
+
+// NodeOf returns an unclustered node representing f.
+func NodeOf(f Family) Node {
+	return Node{id: f.ID, Name: f.Name, Cluster: -1, Members: len(f.Members)}
+}
+
+// Edge is a weighted edge from a shorter family to a longer family.
+type Edge struct {
+	F, T Node
+	W    float64
+}
+
+var _ encoding.Attributer = Edge{}
+
+func (e Edge) From() graph.Node { return e.F }
+func (e Edge) To() graph.Node   { return e.T }
+func (e Edge) Weight() float64  { return e.W }
+func (e Edge) Attributes() []encoding.Attribute {
+	return []encoding.Attribute{{"weight", strconv.FormatFloat(e.W, 'g', -1, 64)}}
+}
+
+// IntSet is a set of IDs.
+type IntSet map[int64]struct{}
+
+func (s IntSet) Add(i int64) {
+	s[i] = struct{}{}
+}
+
+func (s IntSet) Has(i int64) bool {
+	_, ok := s[i]
+	return ok
+}
+
+// PairSet is a set of unordered ID pairs.
+type PairSet map[[2]int64]struct{}
+
+func (s PairSet) Add(i, j int64) {
+	if i > j {
+		i, j = j, i
+	}
+	s[[2]int64{i, j}] = struct{}{}
+}
+
+func (s PairSet) Has(i, j int64) bool {
+	if i > j {
+		i, j = j, i
+	}
+	_, ok := s[[2]int64{i, j}]
+	return ok
+}
+
+// Directed returns a weighted directed graph holding the edges in edges
+// that are between members, or all edges if members is nil. The self
+// and absent parameters are as for simple.NewWeightedDirectedGraph. Only
+// the first of a set of duplicate edges is included.
+func Directed(edges []Edge, members IntSet, self, absent float64) *simple.WeightedDirectedGraph {
+	g := simple.NewWeightedDirectedGraph(self, absent)
+	seen := make(map[[2]int64]struct{})
+outer:
+	for _, e := range edges {
+		for _, n := range []graph.Node{e.From(), e.To()} {
+			if members != nil && !members.Has(n.ID()) {
+				continue outer
+			}
+		}
+		uv := [2]int64{e.F.ID(), e.T.ID()}
+		if _, ok := seen[uv]; ok {
+			continue
+		}
+		seen[uv] = struct{}{}
+		for _, n := range []graph.Node{e.From(), e.To()} {
+			if !g.Has(n) {
+				g.AddNode(n)
+			}
+		}
+		g.SetWeightedEdge(e)
+	}
+	return g
+}
+
+// Undirected returns an undirected graph holding the edges in edges
+// that are between members, or all edges if members is nil. Only the
+// first edge between a pair of nodes is included.
+func Undirected(edges []Edge, members IntSet) *simple.UndirectedGraph {
+	g := simple.NewUndirectedGraph()
+	seen := make(PairSet)
+outer:
+	for _, e := range edges {
+		for _, n := range []graph.Node{e.From(), e.To()} {
+			if members != nil && !members.Has(n.ID()) {
+				continue outer
+			}
+		}
+		if seen.Has(e.F.ID(), e.T.ID()) {
+			continue
+		}
+		seen.Add(e.F.ID(), e.T.ID())
+		for _, n := range []graph.Node{e.From(), e.To()} {
+			if !g.Has(n) {
+				g.AddNode(n)
+			}
+		}
+		g.SetEdge(e)
+	}
+	return g
+}
+
+// Density returns the ratio of edges to the number of possible
+// undirected edges between n nodes. The density of a graph with
+// fewer than two nodes is zero.
+func Density(edges, n int) float64 {
+	if n < 2 {
+		return 0
+	}
+	return float64(edges) / float64(n*(n-1)/2)
+}
+
+// PairsIn returns the number of distinct unordered node pairs
+// joined by edges.
+func PairsIn(edges []Edge) int {
+	seen := make(PairSet)
+	for _, e := range edges {
+		seen.Add(e.F.ID(), e.T.ID())
+	}
+	return len(seen)
+}
+
+// edgesIn returns the number of distinct unordered node pairs
+// within n joined by edges in g.
+func edgesIn(g graph.Directed, n []graph.Node) int {
+	in := make(IntSet)
+	for _, u := range n {
+		in.Add(u.ID())
+	}
+	seen := make(PairSet)
+	// We could use graph.Undirect here, but the
+	// overhead increases and we don't actually
+	// need all the nodes, just the edges.
+	for _, u := range n {
+		uid := u.ID()
+		for _, v := range g.From(u) {
+			vid := v.ID()
+			if !in.Has(vid) {
+				continue
+			}
+			seen.Add(uid, vid)
+		}
+		for _, v := range g.To(u) {
+			vid := v.ID()
+			if !in.Has(vid) {
+				continue
+			}
+			seen.Add(uid, vid)
+		}
+	}
+	return len(seen)
+}
@@ -0,0 +1,244 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/community"
+	"gonum.org/v1/gonum/graph/network"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// Group is a cluster of families.
+type Group struct {
+	Members     []Family
+	IsClique    bool
+	Density     float64
+	Cliques     [][]int64
+	Communities [][]int64
+	PageRank    Ranks
+}
+
+// GroupConfig specifies the parameters for grouping families.
+type GroupConfig struct {
+	// Method specifies the clustering
+	// Method, louvain if empty or
+	// label-propagation.
+	Method string
+
+	// Seed seeds the random sources
+	// used by randomised steps.
+	Seed int64
+
+	Resolution   float64
+	MinSubClique int
+	Cliques      bool
+
+	// WeightedCliques specifies that only the
+	// cliques with the greatest summed edge
+	// weight are reported for each group.
+	WeightedCliques bool
+
+	// Percolation specifies the clique size
+	// for k-clique percolation communities.
+	// No communities are found if it is zero.
+	Percolation int
+
+	// MinMembers specifies the minimum number
+	// of members of a reported group. Smaller
+	// groups are not ranked or searched for
+	// cliques and their families are left
+	// unclustered. There is no limit if it is
+	// zero.
+	MinMembers int
+
+	// Damping and Tolerance are the PageRank
+	// damping factor and convergence tolerance
+	// used to rank group members. If zero, 0.85
+	// and 1e-6 are used.
+	Damping, Tolerance float64
+}
+
+// Groups returns the clusters of fams joined by edges according to cfg.
+// It returns an error if cfg.Method is not a known clustering method.
+// Clusters of a single family, which label propagation may leave when
+// it stops before converging, are not returned, so every returned group
+// is ranked.
+func Groups(fams []Family, edges []Edge, cfg GroupConfig) ([]Group, error) {
+	g := Directed(edges, nil, 0, 0)
+
+	familyIndexOf := make(map[int64]int, len(fams))
+	for i, f := range fams {
+		familyIndexOf[f.ID] = i
+	}
+	damping, tol := cfg.Damping, cfg.Tolerance
+	if damping == 0 {
+		damping = 0.85
+	}
+	if tol == 0 {
+		tol = 1e-6
+	}
+	var grps []Group
+	src := newRand(cfg.Seed, clusterStream)
+	var communities [][]graph.Node
+	switch cfg.Method {
+	case "", "louvain":
+		communities = community.Modularize(graph.Undirect{G: g}, cfg.Resolution, src).Communities()
+	case "label-propagation":
+		communities = labelPropagation(edges, src)
+	default:
+		return nil, fmt.Errorf("victor: unknown cluster method %q", cfg.Method)
+	}
+	for _, c := range communities {
+		if len(c) < 2 || len(c) < cfg.MinMembers {
+			continue
+		}
+		var grp Group
+		for _, n := range c {
+			grp.Members = append(grp.Members, fams[familyIndexOf[n.ID()]])
+		}
+		n := edgesIn(g, c)
+		grp.Density = Density(n, len(c))
+		if len(grp.Members) == 2 || n*2 == len(c)*(len(c)-1) {
+			grp.IsClique = true
+		} else if cfg.Cliques || cfg.WeightedCliques {
+			grp.Cliques = CliquesIn(grp, edges, cfg.MinSubClique)
+			if cfg.WeightedCliques {
+				grp.Cliques = heaviest(grp.Cliques, edges)
+			}
+		}
+		grp.PageRank = RanksOf(grp, edges, damping, tol)
+		if cfg.Percolation > 1 {
+			if grp.IsClique {
+				if len(grp.Members) >= cfg.Percolation {
+					grp.Communities = [][]int64{rankOrdered(grp.PageRank, groupIDs(grp))}
+				}
+			} else {
+				for _, c := range percolated(CliquesIn(grp, edges, cfg.Percolation), cfg.Percolation) {
+					grp.Communities = append(grp.Communities, rankOrdered(grp.PageRank, c))
+				}
+			}
+		}
+
+		grps = append(grps, grp)
+	}
+
+	return grps, nil
+}
+
+// CliquesIn returns the IDs of the maximal cliques of at least min
+// members in grp.
+func CliquesIn(grp Group, edges []Edge, min int) [][]int64 {
+	members := make(IntSet)
+	for _, fam := range grp.Members {
+		members.Add(fam.ID)
+	}
+	g := Undirected(edges, members)
+
+	clqs := topo.BronKerbosch(g)
+	var cliqueIDs [][]int64
+	for _, clq := range clqs {
+		if len(clq) < min {
+			continue
+		}
+		ids := make([]int64, 0, len(clq))
+		for _, n := range clq {
+			ids = append(ids, n.ID())
+		}
+		cliqueIDs = append(cliqueIDs, ids)
+	}
+
+	return cliqueIDs
+}
+
+// CoresIn returns the core number of each member of grp in the
+// undirected graph of edges between members, keyed by family ID. The
+// core number of a family is the greatest k for which it is in the
+// k-core of the group, the largest subgraph in which every family is
+// joined to at least k others. Unlike cliques, k-cores include densely
+// connected families that are not all joined to each other.
+func CoresIn(grp Group, edges []Edge) map[int64]int {
+	members := make(IntSet)
+	for _, fam := range grp.Members {
+		members.Add(fam.ID)
+	}
+	g := Undirected(edges, members)
+
+	_, cores := topo.DegeneracyOrdering(g)
+	core := make(map[int64]int, len(members))
+	for k, shell := range cores {
+		for _, n := range shell {
+			core[n.ID()] = k
+		}
+	}
+	return core
+}
+
+// heaviest returns the cliques in clqs with the greatest sum of
+// weights of edges between clique members.
+func heaviest(clqs [][]int64, edges []Edge) [][]int64 {
+	weight := make(map[[2]int64]float64)
+	for _, e := range edges {
+		weight[[2]int64{e.F.ID(), e.T.ID()}] = e.W
+	}
+	var (
+		max  = math.Inf(-1)
+		best [][]int64
+	)
+	for _, clq := range clqs {
+		var w float64
+		for _, u := range clq {
+			for _, v := range clq {
+				w += weight[[2]int64{u, v}]
+			}
+		}
+		switch {
+		case w > max:
+			max = w
+			best = append(best[:0], clq)
+		case w == max:
+			best = append(best, clq)
+		}
+	}
+	return best
+}
+
+// RanksOf returns the PageRanks of the members of grp in descending
+// order, calculated with the given damping factor and tolerance. Equal
+// ranks are ordered by ascending ID.
+func RanksOf(grp Group, edges []Edge, damping, tol float64) Ranks {
+	members := make(IntSet)
+	for _, fam := range grp.Members {
+		members.Add(fam.ID)
+	}
+	g := Directed(edges, members, 0, math.Inf(1))
+
+	r := network.PageRank(g, damping, tol)
+	o := make(Ranks, 0, len(r))
+	for id, rnk := range r {
+		o = append(o, Rank{ID: id, Rank: rnk})
+	}
+	sort.Sort(o)
+	return o
+}
+
+// Rank is the PageRank of a family.
+type Rank struct {
+	ID   int64
+	Rank float64
+}
+
+// Ranks sorts ranks in descending order.
+type Ranks []Rank
+
+func (o Ranks) Len() int { return len(o) }
+func (o Ranks) Less(i, j int) bool {
+	return o[i].Rank > o[j].Rank || (o[i].Rank == o[j].Rank && o[i].ID < o[j].ID)
+}
+func (o Ranks) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
@@ -0,0 +1,215 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/biogo/biogo/seq"
+	"github.com/biogo/store/step"
+)
+
+// strands is a set of feature orientations.
+type strands uint8
+
+const (
+	plusStrand strands = 1 << iota
+	minusStrand
+	noStrand
+)
+
+// strandOf returns the strands value for the orientation s.
+func strandOf(s seq.Strand) strands {
+	switch s {
+	case seq.Plus:
+		return plusStrand
+	case seq.Minus:
+		return minusStrand
+	default:
+		return noStrand
+	}
+}
+
+// Orientation specifies how strand agreement between families affects
+// their intersection.
+type Orientation struct {
+	// Penalty is the multiplier applied to the
+	// contribution of bases where the families
+	// disagree on strand.
+	Penalty float64
+
+	// UnknownAgrees specifies that members with
+	// unspecified strand agree with both strands.
+	// Otherwise they agree with neither.
+	UnknownAgrees bool
+}
+
+// agrees returns whether a pair of families covering a position with the
+// orientations s and t agree on strand.
+func (o Orientation) agrees(s, t strands) bool {
+	return s&t&(plusStrand|minusStrand) != 0 || (o.UnknownAgrees && (s|t)&noStrand != 0)
+}
+
+// pair is a [2]strands type satisfying the step.Equaler interface.
+// A zero element indicates the corresponding family does not cover
+// the position.
+type pair [2]strands
+
+// Equal returns whether p equals e. Equal assumes the underlying type of e is pair.
+func (p pair) Equal(e step.Equaler) bool {
+	return p == e.(pair)
+}
+
+// cover holds the orientations of the members of a family covering a
+// position and the number of members covering it. It satisfies the
+// step.Equaler interface.
+type cover struct {
+	strand strands
+	depth  int
+}
+
+// Equal returns whether c equals e. Equal assumes the underlying type of e is cover.
+func (c cover) Equal(e step.Equaler) bool {
+	return c == e.(cover)
+}
+
+// segment is an interval over which the cover of a family is constant.
+type segment struct {
+	start, end int
+	cover
+}
+
+// Segments is the coverage of a family on each chromosome as sorted,
+// non-overlapping segments of constant member orientation and depth.
+type Segments map[string][]segment
+
+// NewSegments returns the segments covered by the features in v.
+func NewSegments(v []Feature) (Segments, error) {
+	// Vectors are made to span the extent of the
+	// features on each chromosome since applying
+	// a range that extends a relaxed vector below
+	// its start does not apply to the extension.
+	vecs := make(map[string]*step.Vector)
+	for chr, e := range Extents(v) {
+		vec, err := step.New(e.Start, e.End, cover{})
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d-%d: %v", chr, e.Start, e.End, err)
+		}
+		vecs[chr] = vec
+	}
+	for _, f := range v {
+		vec := vecs[f.Chr]
+		s := strandOf(f.Orient)
+		err := vec.ApplyRange(f.Start, f.End, func(e step.Equaler) step.Equaler {
+			c := e.(cover)
+			c.strand |= s
+			c.depth++
+			return c
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d-%d: %v", f.Chr, f.Start, f.End, err)
+		}
+	}
+	segs := make(Segments, len(vecs))
+	for chr, vec := range vecs {
+		vec.Do(func(start, end int, e step.Equaler) {
+			if c := e.(cover); c.strand != 0 {
+				segs[chr] = append(segs[chr], segment{start: start, end: end, cover: c})
+			}
+		})
+	}
+	return segs, nil
+}
+
+// length returns the number of bases covered by s.
+func (s Segments) length() int {
+	var n int
+	for _, segs := range s {
+		for _, g := range segs {
+			n += g.end - g.start
+		}
+	}
+	return n
+}
+
+// segmentsOf returns the segments of f, calculating them if they are
+// not held by f.
+func segmentsOf(f Family) (Segments, error) {
+	if f.Segments != nil {
+		return f.Segments, nil
+	}
+	segs, err := NewSegments(f.Coords())
+	if err != nil {
+		return nil, fmt.Errorf("family %d %v", f.ID, err)
+	}
+	return segs, nil
+}
+
+// Similarity holds the intersection of a pair of families.
+type Similarity struct {
+	A, B         int64
+	Upper, Lower float64
+	Intersect    int
+
+	// Raw is the summed overlap of all pairs
+	// of members of the families.
+	Raw int
+}
+
+// Intersection returns the intersection of a and b as fractions of the
+// shorter and longer family lengths, and as a number of bases. The
+// contribution to the fractional intersection of bases where a and b
+// disagree on strand according to o is multiplied by the orientation
+// penalty. The raw intersection is the number of bases of overlap summed
+// over all pairs of members of a and b, so bases covered by more than one
+// member of a family are counted for each member.
+func Intersection(a, b Family, o Orientation) (upper, lower float64, intersect, raw int, err error) {
+	as, err := segmentsOf(a)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	bs, err := segmentsOf(b)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	aLen, bLen := as.length(), bs.length()
+	if aLen != a.Length || bLen != b.Length {
+		return 0, 0, 0, 0, fmt.Errorf("length mismatch for families %d and %d: computed %d and %d, expected %d and %d",
+			a.ID, b.ID, aLen, bLen, a.Length, b.Length)
+	}
+
+	var agreed int
+	for chr, u := range as {
+		v := bs[chr]
+		for i, j := 0, 0; i < len(u) && j < len(v); {
+			if n := min(u[i].end, v[j].end) - max(u[i].start, v[j].start); n > 0 {
+				intersect += n
+				if o.agrees(u[i].strand, v[j].strand) {
+					agreed += n
+				}
+				raw += n * u[i].depth * v[j].depth
+			}
+			if u[i].end < v[j].end {
+				i++
+			} else {
+				j++
+			}
+		}
+	}
+
+	upper, lower, intersect = fractions(a, b, agreed, intersect, o)
+	return upper, lower, intersect, raw, nil
+}
+
+// fractions returns the upper and lower intersections of a and b given
+// the number of intersecting bases and the number of those agreeing on
+// strand according to o, and the number of intersecting bases.
+func fractions(a, b Family, agreed, intersect int, o Orientation) (upper, lower float64, n int) {
+	matched := float64(agreed) + o.Penalty*float64(intersect-agreed)
+	upper = matched / math.Min(float64(a.Length), float64(b.Length))
+	lower = matched / math.Max(float64(a.Length), float64(b.Length))
+	return upper, lower, intersect
+}
@@ -0,0 +1,90 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metrics holds the similarity metrics of a pair of families.
+type Metrics struct {
+	// Upper and Lower are the intersection as
+	// fractions of the shorter and longer
+	// family lengths.
+	Upper, Lower float64
+
+	// Jaccard is the intersection as a
+	// fraction of the union of the families.
+	Jaccard float64
+}
+
+// MetricsOf returns the metrics for a pair of families with the given
+// upper and lower intersections.
+func MetricsOf(upper, lower float64) Metrics {
+	m := Metrics{Upper: upper, Lower: lower}
+	// With a shorter family length s, a longer family
+	// length l and an intersection i, upper is i/s and
+	// lower is i/l, so the Jaccard index i/(s+l-i) can
+	// be found without the lengths.
+	if upper != 0 && lower != 0 {
+		m.Jaccard = upper * lower / (upper + lower - upper*lower)
+	}
+	return m
+}
+
+// term is a weighted similarity metric.
+type term struct {
+	coef   float64
+	metric string
+}
+
+// Composite is a linear combination of similarity metrics.
+type Composite []term
+
+// ParseComposite parses a composite metric expression. The expression
+// is a sum of terms separated by "+", where each term is a metric name,
+// one of upper, lower or jaccard, optionally preceded by a coefficient
+// and "*", for example "0.7*upper+0.3*jaccard".
+func ParseComposite(expr string) (Composite, error) {
+	var c Composite
+	for _, f := range strings.Split(expr, "+") {
+		t := term{coef: 1}
+		f = strings.TrimSpace(f)
+		if i := strings.Index(f, "*"); i >= 0 {
+			var err error
+			t.coef, err = strconv.ParseFloat(strings.TrimSpace(f[:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid coefficient in %q: %v", f, err)
+			}
+			f = strings.TrimSpace(f[i+1:])
+		}
+		switch f {
+		case "upper", "lower", "jaccard":
+		default:
+			return nil, fmt.Errorf("unknown metric %q", f)
+		}
+		t.metric = f
+		c = append(c, t)
+	}
+	return c, nil
+}
+
+// Weight returns the value of the composite metric for m.
+func (c Composite) Weight(m Metrics) float64 {
+	var w float64
+	for _, t := range c {
+		switch t.metric {
+		case "upper":
+			w += t.coef * m.Upper
+		case "lower":
+			w += t.coef * m.Lower
+		case "jaccard":
+			w += t.coef * m.Jaccard
+		}
+	}
+	return w
+}
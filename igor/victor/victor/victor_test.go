@@ -0,0 +1,647 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/biogo/biogo/seq"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func newTestFamily(id int64, v []Feature) Family {
+	n, err := Length(v)
+	if err != nil {
+		panic(err)
+	}
+	return Family{ID: id, Members: v, Length: n}
+}
+
+func (s *S) TestIntersectionOrientation(c *check.C) {
+	for i, t := range []struct {
+		a, b   []Feature
+		orient Orientation
+
+		upper, lower float64
+		intersect    int
+	}{
+		{
+			a:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Plus}},
+			b:      []Feature{{Chr: "1", Start: 50, End: 250, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 1, UnknownAgrees: true},
+			upper:  0.5, lower: 0.25, intersect: 50,
+		},
+		{
+			a:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Plus}},
+			b:      []Feature{{Chr: "1", Start: 50, End: 250, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: true},
+			upper:  0, lower: 0, intersect: 50,
+		},
+		{
+			a:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Plus}},
+			b:      []Feature{{Chr: "1", Start: 50, End: 250, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0.5, UnknownAgrees: true},
+			upper:  0.25, lower: 0.125, intersect: 50,
+		},
+		{
+			// Mixed strand family.
+			a: []Feature{
+				{Chr: "1", Start: 0, End: 50, Orient: seq.Plus},
+				{Chr: "1", Start: 50, End: 100, Orient: seq.Minus},
+			},
+			b:      []Feature{{Chr: "1", Start: 0, End: 200, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: true},
+			upper:  0.5, lower: 0.25, intersect: 100,
+		},
+		{
+			// Overlapping mixed strand members.
+			a: []Feature{
+				{Chr: "1", Start: 0, End: 100, Orient: seq.Plus},
+				{Chr: "1", Start: 0, End: 100, Orient: seq.Minus},
+			},
+			b:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: false},
+			upper:  1, lower: 1, intersect: 100,
+		},
+		{
+			// Unknown strand agreeing with both.
+			a:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.None}},
+			b:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: true},
+			upper:  1, lower: 1, intersect: 100,
+		},
+		{
+			// Unknown strand agreeing with neither.
+			a:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.None}},
+			b:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: false},
+			upper:  0, lower: 0, intersect: 100,
+		},
+		{
+			// Unknown strand on both.
+			a:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.None}},
+			b:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.None}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: false},
+			upper:  0, lower: 0, intersect: 100,
+		},
+		{
+			// Mixed known and unknown strand.
+			a: []Feature{
+				{Chr: "1", Start: 0, End: 50, Orient: seq.None},
+				{Chr: "1", Start: 50, End: 100, Orient: seq.Plus},
+			},
+			b:      []Feature{{Chr: "1", Start: 0, End: 100, Orient: seq.Minus}},
+			orient: Orientation{Penalty: 0, UnknownAgrees: true},
+			upper:  0.5, lower: 0.5, intersect: 100,
+		},
+	} {
+		a, b := newTestFamily(0, t.a), newTestFamily(1, t.b)
+		upper, lower, intersect, _, err := Intersection(a, b, t.orient)
+		c.Assert(err, check.IsNil, check.Commentf("Test %d", i))
+		c.Check(upper, check.Equals, t.upper, check.Commentf("Test %d", i))
+		c.Check(lower, check.Equals, t.lower, check.Commentf("Test %d", i))
+		c.Check(intersect, check.Equals, t.intersect, check.Commentf("Test %d", i))
+
+		a.Weight, err = WeightedLength(t.a)
+		a.Weighted = true
+		c.Assert(err, check.IsNil, check.Commentf("Test %d weighted", i))
+		b.Weight, err = WeightedLength(t.b)
+		b.Weighted = true
+		c.Assert(err, check.IsNil, check.Commentf("Test %d weighted", i))
+		upper, lower, intersect, err = WeightedIntersection(a, b, t.orient)
+		c.Assert(err, check.IsNil, check.Commentf("Test %d weighted", i))
+		c.Check(upper, check.Equals, t.upper, check.Commentf("Test %d weighted", i))
+		c.Check(lower, check.Equals, t.lower, check.Commentf("Test %d weighted", i))
+		c.Check(intersect, check.Equals, t.intersect, check.Commentf("Test %d weighted", i))
+	}
+}
+
+func (s *S) TestRawIntersection(c *check.C) {
+	for i, t := range []struct {
+		a, b []Feature
+
+		intersect, raw int
+	}{
+		{
+			a:         []Feature{{Chr: "1", Start: 0, End: 100}},
+			b:         []Feature{{Chr: "1", Start: 50, End: 250}},
+			intersect: 50, raw: 50,
+		},
+		{
+			// Redundant members of one family.
+			a: []Feature{
+				{Chr: "1", Start: 0, End: 100},
+				{Chr: "1", Start: 0, End: 100},
+				{Chr: "1", Start: 50, End: 100},
+			},
+			b:         []Feature{{Chr: "1", Start: 50, End: 250}},
+			intersect: 50, raw: 150,
+		},
+		{
+			// Redundant members of both families.
+			a: []Feature{
+				{Chr: "1", Start: 0, End: 100},
+				{Chr: "1", Start: 0, End: 100},
+			},
+			b: []Feature{
+				{Chr: "1", Start: 50, End: 250},
+				{Chr: "1", Start: 90, End: 150},
+			},
+			intersect: 50, raw: 120,
+		},
+	} {
+		a, b := newTestFamily(0, t.a), newTestFamily(1, t.b)
+		_, _, intersect, raw, err := Intersection(a, b, Orientation{Penalty: 1, UnknownAgrees: true})
+		c.Assert(err, check.IsNil, check.Commentf("Test %d", i))
+		c.Check(intersect, check.Equals, t.intersect, check.Commentf("Test %d", i))
+		c.Check(raw, check.Equals, t.raw, check.Commentf("Test %d", i))
+	}
+}
+
+func (s *S) TestIntersectionLengthMismatch(c *check.C) {
+	a := newTestFamily(0, []Feature{{Chr: "1", Start: 0, End: 100}})
+	b := newTestFamily(1, []Feature{{Chr: "1", Start: 50, End: 250}})
+	b.Length = 100
+	_, _, _, _, err := Intersection(a, b, Orientation{Penalty: 1, UnknownAgrees: true})
+	c.Check(err, check.ErrorMatches, "length mismatch for families 0 and 1: computed 100 and 200, expected 100 and 100")
+}
+
+func (s *S) TestByMembers(c *check.C) {
+	one := []Feature{{Chr: "1", Start: 0, End: 10}}
+	two := append(one, Feature{Chr: "1", Start: 20, End: 30})
+	fams := []Family{
+		{ID: 3, Members: one},
+		{ID: 1, Members: two},
+		{ID: 0, Members: one},
+		{ID: 2, Members: two},
+		{ID: 4, Members: one},
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(fams), func(i, j int) { fams[i], fams[j] = fams[j], fams[i] })
+	sort.Sort(ByMembers(fams))
+	var got []int64
+	for _, f := range fams {
+		got = append(got, f.ID)
+	}
+	c.Check(got, check.DeepEquals, []int64{1, 2, 0, 3, 4})
+}
+
+func (s *S) TestZeroWeight(c *check.C) {
+	var v []Feature
+	err := json.Unmarshal([]byte(`[{"C":"1","S":0,"E":100,"W":0},{"C":"1","S":100,"E":200},{"C":"1","S":200,"E":300,"W":2}]`), &v)
+	c.Assert(err, check.IsNil)
+	c.Check(v[0].weight(), check.Equals, 0.0, check.Commentf("expected explicit zero weight to be retained"))
+	c.Check(v[1].weight(), check.Equals, 1.0, check.Commentf("expected absent weight to be 1"))
+	w, err := WeightedLength(v)
+	c.Assert(err, check.IsNil)
+	c.Check(w, check.Equals, 300.0)
+
+	// Families with a weighted length of zero
+	// are not compared.
+	zero := 0.0
+	fams := []Family{
+		newTestFamily(0, []Feature{{Chr: "1", Start: 0, End: 100, Weight: &zero}}),
+		newTestFamily(1, []Feature{{Chr: "1", Start: 0, End: 100}}),
+	}
+	for i := range fams {
+		fams[i].Weight, err = WeightedLength(fams[i].Members)
+		c.Assert(err, check.IsNil)
+		fams[i].Weighted = true
+	}
+	c.Check(fams[0].Size(), check.Equals, 0.0)
+	conn := Connector{limit: make(chan struct{}, 1), Weighted: true}
+	edges, err := conn.EdgesFor(fams, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(len(edges), check.Equals, 0)
+	c.Check(conn.Evaluated, check.Equals, 0)
+}
+
+func (s *S) TestDuplicateEdges(c *check.C) {
+	n := []Node{{id: 0}, {id: 1}, {id: 2}}
+	edges := []Edge{
+		{F: n[0], T: n[1], W: 1},
+		{F: n[0], T: n[1], W: 2},
+		{F: n[1], T: n[0], W: 1},
+		{F: n[1], T: n[2], W: 1},
+		{F: n[1], T: n[2], W: 1},
+	}
+
+	g := Directed(edges, nil, 0, 0)
+	for i, want := range []int{1, 2, 0} {
+		u := n[i]
+		c.Check(len(g.From(u)), check.Equals, want, check.Commentf("directed node %d", i))
+	}
+	for _, e := range g.Edges() {
+		if e.From().ID() == 0 && e.To().ID() == 1 {
+			c.Check(e.(Edge).W, check.Equals, 1.0, check.Commentf("expected first duplicate edge to be kept"))
+		}
+	}
+
+	ug := Undirected(edges, nil)
+	for i, want := range []int{1, 2, 1} {
+		u := n[i]
+		c.Check(len(ug.From(u)), check.Equals, want, check.Commentf("undirected node %d", i))
+	}
+
+	members := make(IntSet)
+	members.Add(0)
+	members.Add(1)
+	g2 := Undirected(edges, members)
+	c.Check(len(g2.Nodes()), check.Equals, 2)
+	c.Check(len(g2.Edges()), check.Equals, 1)
+}
+
+func (s *S) TestDisjointFamilies(c *check.C) {
+	cl := NewClusterer(ClusterConfig{Thresh: 0})
+	for i, chr := range []string{"1", "2", "1"} {
+		err := cl.Add(newTestFamily(int64(i), []Feature{{Chr: chr, Start: 0, End: 100}}))
+		c.Assert(err, check.IsNil)
+	}
+	c.Check(cl.conn.Evaluated, check.Equals, 1, check.Commentf("expected families on different chromosomes to be skipped"))
+}
+
+func (s *S) TestClustererAddError(c *check.C) {
+	withBits := func(f Family) Family {
+		f.Bits = NewFamilyBits(f.Members, Extents(f.Members))
+		return f
+	}
+	cl := NewClusterer(ClusterConfig{Thresh: 0})
+	c.Assert(cl.Add(withBits(newTestFamily(0, []Feature{{Chr: "1", Start: 0, End: 100}}))), check.IsNil)
+	c.Assert(cl.Add(newTestFamily(1, []Feature{{Chr: "1", Start: 0, End: 100}})), check.IsNil)
+	edges := len(cl.conn.edges)
+
+	// The bitset comparison with family 0 succeeds
+	// while the comparison with family 1 fails.
+	bad := withBits(newTestFamily(2, []Feature{{Chr: "1", Start: 0, End: 100}}))
+	bad.Length = 50
+	c.Check(cl.Add(bad), check.NotNil)
+	c.Check(len(cl.families), check.Equals, 2)
+	c.Check(len(cl.conn.edges), check.Equals, edges, check.Commentf("expected edges of rejected family to be discarded"))
+
+	c.Check(cl.Add(newTestFamily(3, []Feature{{Chr: "1", Start: 0, End: 100}})), check.IsNil, check.Commentf("expected error not to persist"))
+	c.Check(len(cl.families), check.Equals, 3)
+}
+
+func (s *S) TestZeroLengthFamily(c *check.C) {
+	fams := []Family{
+		{ID: 0, Members: []Feature{{Chr: "1", Start: 10, End: 10}}},
+		newTestFamily(1, []Feature{{Chr: "1", Start: 0, End: 100}}),
+		newTestFamily(2, []Feature{{Chr: "1", Start: 50, End: 150}}),
+	}
+	conn := Connector{limit: make(chan struct{}, 1), Orient: Orientation{Penalty: 1, UnknownAgrees: true}}
+	edges, err := conn.EdgesFor(fams, 0)
+	c.Assert(err, check.IsNil)
+	c.Check(len(edges), check.Equals, 2)
+	for _, e := range edges {
+		c.Check(e.F.ID(), check.Not(check.Equals), int64(0))
+		c.Check(e.T.ID(), check.Not(check.Equals), int64(0))
+		c.Check(math.IsNaN(e.W), check.Equals, false)
+	}
+
+	conn = Connector{}
+	conn.link(fams[1], fams[2], math.NaN(), math.NaN(), 0, 0)
+	c.Check(len(conn.edges), check.Equals, 0, check.Commentf("expected NaN weight to be rejected"))
+
+	conn = Connector{limit: make(chan struct{}, 1), Similar: func(a, b Family) (float64, bool) { return math.NaN(), true }}
+	edges, err = conn.EdgesFor(fams[1:], 0)
+	c.Assert(err, check.IsNil)
+	c.Check(len(edges), check.Equals, 0, check.Commentf("expected NaN similarity to be rejected"))
+}
+
+func (s *S) TestMinMembers(c *check.C) {
+	var fams []Family
+	for i := int64(0); i < 5; i++ {
+		fams = append(fams, newTestFamily(i, []Feature{{Chr: "1", Start: 0, End: 100}}))
+	}
+	n := func(id int) Node { return NodeOf(fams[id]) }
+	edges := []Edge{
+		{F: n(0), T: n(1), W: 1},
+		{F: n(2), T: n(3), W: 1},
+		{F: n(3), T: n(4), W: 1},
+		{F: n(2), T: n(4), W: 1},
+	}
+	for _, test := range []struct {
+		min  int
+		want []int
+	}{
+		{min: 0, want: []int{2, 3}},
+		{min: 3, want: []int{3}},
+		{min: 4, want: nil},
+	} {
+		var got []int
+		grps, err := Groups(fams, edges, GroupConfig{MinMembers: test.min})
+		c.Assert(err, check.IsNil)
+		for _, g := range grps {
+			got = append(got, len(g.Members))
+		}
+		sort.Ints(got)
+		c.Check(got, check.DeepEquals, test.want, check.Commentf("minimum %d", test.min))
+	}
+
+	_, err := Groups(fams, edges, GroupConfig{Method: "unknown"})
+	c.Check(err, check.NotNil)
+}
+
+func (s *S) TestRanksOfOrder(c *check.C) {
+	var grp Group
+	for i := int64(0); i < 5; i++ {
+		grp.Members = append(grp.Members, newTestFamily(i, []Feature{{Chr: "1", Start: 0, End: 100}}))
+	}
+	// A near-uniform clique gives ranks that differ
+	// by less than the tolerance.
+	var edges []Edge
+	for i, a := range grp.Members {
+		for j, b := range grp.Members {
+			if i != j {
+				edges = append(edges, Edge{F: NodeOf(a), T: NodeOf(b), W: 1 + float64(i+j)*1e-6})
+			}
+		}
+	}
+	ranks := RanksOf(grp, edges, 0.85, 1e-3)
+	c.Assert(len(ranks), check.Equals, 5)
+	for i := 1; i < len(ranks); i++ {
+		c.Check(ranks[i-1].Rank >= ranks[i].Rank, check.Equals, true, check.Commentf("ranks not in descending order: %v", ranks))
+	}
+}
+
+func (s *S) TestCoresIn(c *check.C) {
+	var grp Group
+	for i := int64(0); i < 5; i++ {
+		grp.Members = append(grp.Members, newTestFamily(i, []Feature{{Chr: "1", Start: 0, End: 100}}))
+	}
+	n := func(id int) Node { return NodeOf(grp.Members[id]) }
+	edges := []Edge{
+		{F: n(0), T: n(1), W: 1},
+		{F: n(1), T: n(2), W: 1},
+		{F: n(2), T: n(0), W: 1},
+		{F: n(2), T: n(3), W: 1},
+		{F: n(3), T: n(4), W: 1},
+	}
+	c.Check(CoresIn(grp, edges), check.DeepEquals, map[int64]int{0: 2, 1: 2, 2: 2, 3: 1, 4: 1})
+}
+
+func (s *S) TestJaccardEdges(c *check.C) {
+	fams := []Family{
+		newTestFamily(0, []Feature{{Chr: "1", Start: 0, End: 100}}),
+		newTestFamily(1, []Feature{{Chr: "1", Start: 50, End: 200}}),
+	}
+	jaccard, err := ParseComposite("jaccard")
+	c.Assert(err, check.IsNil)
+	for _, test := range []struct {
+		thresh float64
+		want   []float64
+	}{
+		{thresh: 0.2, want: []float64{0.25}},
+		{thresh: 0.3, want: nil},
+	} {
+		conn := NewConnector(1)
+		conn.Orient = Orientation{Penalty: 1, UnknownAgrees: true}
+		conn.Composite = jaccard
+		edges, err := conn.EdgesFor(fams, test.thresh)
+		c.Assert(err, check.IsNil)
+		var got []float64
+		for _, e := range edges {
+			got = append(got, e.W)
+		}
+		c.Check(got, check.DeepEquals, test.want, check.Commentf("thresh=%v", test.thresh))
+	}
+}
+
+func (s *S) TestConnectorWeight(c *check.C) {
+	p := Similarity{Upper: 0.8, Lower: 0.2, Intersect: 20}
+	comp, err := ParseComposite("0.5*upper+0.5*lower")
+	c.Assert(err, check.IsNil)
+	for _, test := range []struct {
+		conn *Connector
+		want float64
+	}{
+		{conn: &Connector{}, want: 0.8},
+		{conn: &Connector{Reciprocal: true}, want: 0.2},
+		{conn: &Connector{Composite: comp}, want: 0.5},
+	} {
+		c.Check(test.conn.Weight(p), check.Equals, test.want)
+	}
+}
+
+func (s *S) TestReciprocalEdges(c *check.C) {
+	fams := []Family{
+		newTestFamily(0, []Feature{{Chr: "1", Start: 0, End: 100}}),
+		newTestFamily(1, []Feature{{Chr: "1", Start: 0, End: 200}}),
+	}
+	for _, test := range []struct {
+		reciprocal bool
+		thresh     float64
+		lower      float64
+		want       []float64
+	}{
+		{reciprocal: false, thresh: 0.6, lower: -1, want: []float64{1}},
+		{reciprocal: false, thresh: 0.4, lower: -1, want: []float64{1, 0.5}},
+		{reciprocal: true, thresh: 0.6, lower: -1, want: nil},
+		{reciprocal: true, thresh: 0.4, lower: -1, want: []float64{0.5}},
+		{reciprocal: false, thresh: 0.4, lower: 0.6, want: []float64{1}},
+		{reciprocal: false, thresh: 0.6, lower: 0.4, want: []float64{1, 0.5}},
+		{reciprocal: false, thresh: 0.6, lower: 0, want: []float64{1, 0.5}},
+	} {
+		conn := NewConnector(1)
+		conn.Orient = Orientation{Penalty: 1, UnknownAgrees: true}
+		conn.Reciprocal = test.reciprocal
+		if test.lower >= 0 {
+			conn.LowerThresh = &test.lower
+		}
+		edges, err := conn.EdgesFor(fams, test.thresh)
+		c.Assert(err, check.IsNil)
+		var got []float64
+		for _, e := range edges {
+			got = append(got, e.W)
+		}
+		c.Check(got, check.DeepEquals, test.want, check.Commentf("reciprocal=%t thresh=%v lower=%v", test.reciprocal, test.thresh, test.lower))
+	}
+}
+
+// benchFamilies returns n families of m members scattered over a
+// 10Mb chromosome.
+func benchFamilies(n, m int) []Family {
+	src := rand.New(rand.NewSource(1))
+	fams := make([]Family, n)
+	for i := range fams {
+		v := make([]Feature, m)
+		for j := range v {
+			start := src.Intn(10e6)
+			v[j] = Feature{Chr: "1", Start: start, End: start + 200 + src.Intn(2000)}
+		}
+		fams[i] = newTestFamily(int64(i), v)
+	}
+	return fams
+}
+
+func BenchmarkIntersection(b *testing.B) {
+	fams := benchFamilies(2, 2000)
+	o := Orientation{Penalty: 1, UnknownAgrees: true}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Intersection(fams[0], fams[1], o)
+	}
+}
+
+func BenchmarkIntersectionSegments(b *testing.B) {
+	fams := benchFamilies(2, 2000)
+	for i := range fams {
+		fams[i].Segments, _ = NewSegments(fams[i].Members)
+	}
+	o := Orientation{Penalty: 1, UnknownAgrees: true}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Intersection(fams[0], fams[1], o)
+	}
+}
+
+func BenchmarkMinHash(b *testing.B) {
+	fams := benchFamilies(2, 2000)
+	sigs := []signature{minHash(fams[0], 128, 100), minHash(fams[1], 128, 100)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		jaccard(sigs[0], sigs[1])
+	}
+}
+
+func BenchmarkMinHashSignature(b *testing.B) {
+	fams := benchFamilies(1, 2000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		minHash(fams[0], 128, 100)
+	}
+}
+
+func (s *S) TestBitsetIntersection(c *check.C) {
+	src := rand.New(rand.NewSource(1))
+	strand := []seq.Strand{seq.Plus, seq.Minus, seq.None}
+	randomFamily := func(id int64) Family {
+		v := make([]Feature, 1+src.Intn(20))
+		for i := range v {
+			start := src.Intn(5000)
+			v[i] = Feature{
+				Chr:    []string{"1", "2"}[src.Intn(2)],
+				Start:  start,
+				End:    start + 1 + src.Intn(500),
+				Orient: strand[src.Intn(len(strand))],
+			}
+		}
+		f := newTestFamily(id, v)
+		f.Bits = NewFamilyBits(v, Extents(v))
+		return f
+	}
+	for i := 0; i < 100; i++ {
+		a, b := randomFamily(0), randomFamily(1)
+		for _, o := range []Orientation{
+			{Penalty: 1, UnknownAgrees: true},
+			{Penalty: 0.3, UnknownAgrees: true},
+			{Penalty: 0.3, UnknownAgrees: false},
+			{Penalty: 0, UnknownAgrees: false},
+		} {
+			upper, lower, intersect, _, err := Intersection(a, b, o)
+			c.Assert(err, check.IsNil)
+			bUpper, bLower, bIntersect := BitsetIntersection(a, b, o)
+			c.Check(bUpper, check.Equals, upper, check.Commentf("Test %d %+v", i, o))
+			c.Check(bLower, check.Equals, lower, check.Commentf("Test %d %+v", i, o))
+			c.Check(bIntersect, check.Equals, intersect, check.Commentf("Test %d %+v", i, o))
+		}
+	}
+}
+
+func (s *S) TestSegmentIntersection(c *check.C) {
+	src := rand.New(rand.NewSource(1))
+	strand := []seq.Strand{seq.Plus, seq.Minus, seq.None}
+	randomFamily := func(id int64) Family {
+		v := make([]Feature, 1+src.Intn(20))
+		for i := range v {
+			start := src.Intn(5000)
+			v[i] = Feature{
+				Chr:    []string{"1", "2"}[src.Intn(2)],
+				Start:  start,
+				End:    start + 1 + src.Intn(500),
+				Orient: strand[src.Intn(len(strand))],
+			}
+		}
+		return newTestFamily(id, v)
+	}
+	// bases returns the strands of the members of f
+	// covering each base.
+	type base struct {
+		chr string
+		pos int
+	}
+	bases := func(f Family) map[base]strands {
+		cov := make(map[base]strands)
+		for _, m := range f.Members {
+			for p := m.Start; p < m.End; p++ {
+				cov[base{m.Chr, p}] |= strandOf(m.Orient)
+			}
+		}
+		return cov
+	}
+	for _, o := range []Orientation{
+		{Penalty: 1, UnknownAgrees: true},
+		{Penalty: 0.3, UnknownAgrees: true},
+		{Penalty: 0, UnknownAgrees: false},
+	} {
+		for i := 0; i < 100; i++ {
+			a, b := randomFamily(0), randomFamily(1)
+			upper, lower, intersect, raw, err := Intersection(a, b, o)
+			c.Assert(err, check.IsNil)
+
+			a.Segments, err = NewSegments(a.Members)
+			c.Assert(err, check.IsNil)
+			b.Segments, err = NewSegments(b.Members)
+			c.Assert(err, check.IsNil)
+			sUpper, sLower, sIntersect, sRaw, err := Intersection(a, b, o)
+			c.Assert(err, check.IsNil)
+			c.Check(sUpper, check.Equals, upper, check.Commentf("Test %d %+v", i, o))
+			c.Check(sLower, check.Equals, lower, check.Commentf("Test %d %+v", i, o))
+			c.Check(sIntersect, check.Equals, intersect, check.Commentf("Test %d %+v", i, o))
+			c.Check(sRaw, check.Equals, raw, check.Commentf("Test %d %+v", i, o))
+
+			// Compare against a base by base oracle.
+			aCov, bCov := bases(a), bases(b)
+			var wantIntersect int
+			var matched float64
+			for pos, s := range aCov {
+				t, ok := bCov[pos]
+				if !ok {
+					continue
+				}
+				wantIntersect++
+				if s&t&(plusStrand|minusStrand) != 0 || (o.UnknownAgrees && (s|t)&noStrand != 0) {
+					matched++
+				} else {
+					matched += o.Penalty
+				}
+			}
+			short, long := float64(min(len(aCov), len(bCov))), float64(max(len(aCov), len(bCov)))
+			c.Check(intersect, check.Equals, wantIntersect, check.Commentf("Test %d %+v", i, o))
+			c.Check(math.Abs(upper-matched/short) < 1e-12, check.Equals, true, check.Commentf("Test %d %+v: got upper %v want %v", i, o, upper, matched/short))
+			c.Check(math.Abs(lower-matched/long) < 1e-12, check.Equals, true, check.Commentf("Test %d %+v: got lower %v want %v", i, o, lower, matched/long))
+
+			var wantRaw int
+			for _, f := range a.Members {
+				for _, g := range b.Members {
+					if f.Chr == g.Chr && f.Start < g.End && g.Start < f.End {
+						wantRaw += min(f.End, g.End) - max(f.Start, g.Start)
+					}
+				}
+			}
+			c.Check(raw, check.Equals, wantRaw, check.Commentf("Test %d %+v", i, o))
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package victor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/biogo/store/step"
+)
+
+// weight returns the weight of f. Features without a weight have
+// a weight of 1; an explicit weight of 0 is retained.
+func (f Feature) weight() float64 {
+	if f.Weight == nil {
+		return 1
+	}
+	return *f.Weight
+}
+
+// stepWeight is a float64 type satisfying the step.Equaler interface.
+type stepWeight float64
+
+// Equal returns whether w equals e. Equal assumes the underlying type of e is a stepWeight.
+func (w stepWeight) Equal(e step.Equaler) bool {
+	return w == e.(stepWeight)
+}
+
+// WeightedLength returns the weighted coverage of v. Where members of
+// v overlap, each base contributes the greatest weight covering it.
+func WeightedLength(v []Feature) (float64, error) {
+	vecs := make(map[string]*step.Vector)
+	for _, f := range v {
+		vec, ok := vecs[f.Chr]
+		if !ok {
+			var err error
+			vec, err = step.New(f.Start, f.End, stepWeight(0))
+			if err != nil {
+				return 0, fmt.Errorf("%s:%d-%d: %v", f.Chr, f.Start, f.End, err)
+			}
+			vec.Relaxed = true
+			vecs[f.Chr] = vec
+		}
+		w := f.weight()
+		err := vec.ApplyRange(f.Start, f.End, func(e step.Equaler) step.Equaler {
+			return stepWeight(math.Max(float64(e.(stepWeight)), w))
+		})
+		if err != nil {
+			return 0, fmt.Errorf("%s:%d-%d: %v", f.Chr, f.Start, f.End, err)
+		}
+	}
+	var len float64
+	for _, vec := range vecs {
+		vec.Do(func(start, end int, e step.Equaler) {
+			len += float64(end-start) * float64(e.(stepWeight))
+		})
+	}
+	return len, nil
+}
+
+// weightPair holds the weights and orientations of a pair of families
+// covering a position. It satisfies the step.Equaler interface.
+type weightPair struct {
+	weight [2]float64
+	strand pair
+}
+
+// Equal returns whether p equals e. Equal assumes the underlying type of e is weightPair.
+func (p weightPair) Equal(e step.Equaler) bool {
+	return p == e.(weightPair)
+}
+
+// WeightedIntersection returns the weighted intersection of a and b as
+// fractions of the shorter and longer family weighted lengths, and the
+// unweighted intersection as a number of bases. Each base in the
+// intersection contributes the lesser of the weights of a and b at that
+// base, multiplied by the orientation penalty if a and b disagree on
+// strand according to o. With unit weights the result is the same as
+// for intersection.
+func WeightedIntersection(a, b Family, o Orientation) (upper, lower float64, intersect int, err error) {
+	vecs := make(map[string]*step.Vector)
+	for i, v := range []Family{a, b} {
+		for _, f := range v.Coords() {
+			vec, ok := vecs[f.Chr]
+			if !ok {
+				vec, err = step.New(f.Start, f.End, weightPair{})
+				if err != nil {
+					return 0, 0, 0, fmt.Errorf("family %d %s:%d-%d: %v", v.ID, f.Chr, f.Start, f.End, err)
+				}
+				vec.Relaxed = true
+				vecs[f.Chr] = vec
+			}
+			w := f.weight()
+			s := strandOf(f.Orient)
+			err := vec.ApplyRange(f.Start, f.End, func(e step.Equaler) step.Equaler {
+				p := e.(weightPair)
+				p.weight[i] = math.Max(p.weight[i], w)
+				p.strand[i] |= s
+				return p
+			})
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("family %d %s:%d-%d: %v", v.ID, f.Chr, f.Start, f.End, err)
+			}
+		}
+	}
+	var weight float64
+	for _, vec := range vecs {
+		vec.Do(func(start, end int, e step.Equaler) {
+			p := e.(weightPair)
+			if p.strand[0] != 0 && p.strand[1] != 0 {
+				intersect += end - start
+				w := float64(end-start) * math.Min(p.weight[0], p.weight[1])
+				if !o.agrees(p.strand[0], p.strand[1]) {
+					w *= o.Penalty
+				}
+				weight += w
+			}
+		})
+	}
+
+	upper = weight / math.Min(a.Weight, b.Weight)
+	lower = weight / math.Max(a.Weight, b.Weight)
+	return upper, lower, intersect, nil
+}
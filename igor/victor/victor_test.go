@@ -0,0 +1,97 @@
+// Copyright ©2014 The bíogo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/biogo/biogo/seq"
+
+	"gopkg.in/check.v1"
+
+	"github.com/biogo/examples/igor/victor/victor"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestNormalizeFamily(c *check.C) {
+	v := []victor.Feature{
+		{Chr: "2", Start: 0, End: 10, Orient: seq.Plus},
+		{Chr: "1", Start: 50, End: 60, Orient: seq.Plus},
+		{Chr: "1", Start: 0, End: 20, Orient: seq.Plus, ID: "a"},
+		{Chr: "1", Start: 10, End: 30, Orient: seq.Plus, ID: "b"},
+		{Chr: "1", Start: 30, End: 40, Orient: seq.Plus},
+		{Chr: "1", Start: 5, End: 15, Orient: seq.Minus},
+	}
+	orig := append([]victor.Feature(nil), v...)
+	got, n := normalizeFamily(v)
+	c.Check(n, check.Equals, 1)
+	c.Check(got, check.DeepEquals, []victor.Feature{
+		{Chr: "1", Start: 5, End: 15, Orient: seq.Minus},
+		{Chr: "1", Start: 0, End: 30, Orient: seq.Plus},
+		{Chr: "1", Start: 30, End: 40, Orient: seq.Plus},
+		{Chr: "1", Start: 50, End: 60, Orient: seq.Plus},
+		{Chr: "2", Start: 0, End: 10, Orient: seq.Plus},
+	})
+	c.Check(v, check.DeepEquals, orig, check.Commentf("expected input to be unaltered"))
+}
+
+func (s *S) TestCheckFeature(c *check.C) {
+	zero, negative := 0.0, -1.0
+	for _, test := range []struct {
+		f     victor.Feature
+		valid bool
+	}{
+		{f: victor.Feature{Chr: "1", Start: 0, End: 10}, valid: true},
+		{f: victor.Feature{Chr: "1", Start: 10, End: 10}, valid: false},
+		{f: victor.Feature{Chr: "1", Start: -10, End: 10}, valid: false},
+		{f: victor.Feature{Chr: "", Start: 0, End: 10}, valid: false},
+		{f: victor.Feature{Chr: "1", Start: 10, End: 0}, valid: false},
+		{f: victor.Feature{Chr: "1", Start: 0, End: 10, Weight: &zero}, valid: true},
+		{f: victor.Feature{Chr: "1", Start: 0, End: 10, Weight: &negative}, valid: false},
+	} {
+		err := checkFeature(test.f)
+		c.Check(err == nil, check.Equals, test.valid, check.Commentf("feature %+v", test.f))
+	}
+}
+
+func (s *S) TestCommandFlags(c *check.C) {
+	used := make(map[string]bool)
+	for cmd := range commands {
+		fs := commandFlags(cmd)
+		fs.VisitAll(func(f *flag.Flag) { used[f.Name] = true })
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if strings.Contains(f.Name, ".") {
+			// Skip testing and check.v1 flags.
+			return
+		}
+		c.Check(used[f.Name], check.Equals, true, check.Commentf("flag -%s not accepted by any command", f.Name))
+	})
+	c.Check(commandFlags("convert").Lookup("thresh"), check.IsNil)
+	c.Check(commandFlags("stats").Lookup("bed"), check.IsNil)
+}
+
+func (s *S) TestReadBEDHeaders(c *check.C) {
+	r := bufio.NewReader(strings.NewReader(`track name=families
+browser position chr1:1-100
+browser
+trackA	0	10	fam.1
+browserB	20	30	fam.1
+`))
+	members, names := readBED(r, ".")
+	c.Assert(names, check.DeepEquals, []string{"fam"})
+	c.Check(members[0], check.DeepEquals, []victor.Feature{
+		{Chr: "trackA", Start: 0, End: 10},
+		{Chr: "browserB", Start: 20, End: 30},
+	})
+}